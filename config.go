@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	userConfigFilename    = "git-tokens/config.yaml"
+	projectConfigFilename = ".git-tokens.yaml"
+
+	configEnv      = "GIT_TOKENS_CONFIG"
+	dbEnv          = "GIT_TOKENS_DB"
+	workdirEnv     = "GIT_TOKENS_WORKDIR"
+	workersEnv     = "GIT_TOKENS_WORKERS"
+	credentialsEnv = "GIT_TOKENS_CREDENTIALS"
+
+	sourceDefault = "default"
+)
+
+const configPrecedence = `Settings are taken from, in order of precedence:
+
+  1. Global flags: --db, --workdir, --workers, --credentials
+  2. Environment: GIT_TOKENS_DB, GIT_TOKENS_WORKDIR, GIT_TOKENS_WORKERS,
+     GIT_TOKENS_CREDENTIALS
+  3. ./.git-tokens.yaml
+  4. ~/.config/git-tokens/config.yaml
+  5. Built-in defaults
+
+--config <file> or GIT_TOKENS_CONFIG replaces both config files. Relative
+paths in a config file are relative to the directory of that file.
+
+allowlist_paths is only read from config files. It lists path globs, such
+as vendor/** or **/*_test.go, whose matches are suppressed. Matches on lines
+containing git-tokens:allow are suppressed as well.`
+
+// config holds the settings in effect and where each of them came from.
+type config struct {
+	DB          string `yaml:"db"`
+	Workdir     string `yaml:"workdir"`
+	Workers     int    `yaml:"workers"`
+	Credentials string `yaml:"credentials"`
+	// AllowlistPaths are globs of files whose matches are suppressed
+	AllowlistPaths []string `yaml:"allowlist_paths"`
+
+	file    string
+	files   []string
+	sources map[string]string
+}
+
+// settings is the order config show prints settings in.
+var settings = []string{"db", "workdir", "workers", "credentials", "allowlist_paths"}
+
+func defaultConfig() config {
+	return config{
+		DB:          scannerDBFilename,
+		Workdir:     scannerWorkingDirectory,
+		Workers:     concurrentScannerWorkers,
+		Credentials: scannerCredentialsFilename,
+		sources: map[string]string{
+			"db":              sourceDefault,
+			"workdir":         sourceDefault,
+			"workers":         sourceDefault,
+			"credentials":     sourceDefault,
+			"allowlist_paths": sourceDefault,
+		},
+	}
+}
+
+func (c config) value(setting string) string {
+	switch setting {
+	case "db":
+		return c.DB
+	case "workdir":
+		return c.Workdir
+	case "workers":
+		return strconv.Itoa(c.Workers)
+	case "credentials":
+		return c.Credentials
+	case "allowlist_paths":
+		return strings.Join(c.AllowlistPaths, ",")
+	}
+
+	return ""
+}
+
+func (c *config) set(setting string, value string, source string) error {
+	switch setting {
+	case "db":
+		c.DB = value
+	case "workdir":
+		c.Workdir = value
+	case "workers":
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 1 {
+			return fmt.Errorf("invalid workers \"%s\" from %s", value, source)
+		}
+		c.Workers = workers
+	case "credentials":
+		c.Credentials = value
+	default:
+		return fmt.Errorf("unknown setting \"%s\"", setting)
+	}
+
+	c.sources[setting] = source
+
+	return nil
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+// merge applies the settings of the config file at path. A missing file is
+// only an error if required is set.
+func (c *config) merge(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	file := config{}
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+	c.files = append(c.files, path)
+
+	source := "file " + path
+	dir := filepath.Dir(path)
+	resolve := func(value string) string {
+		value = expandHome(value)
+		if filepath.IsAbs(value) {
+			return value
+		}
+		return filepath.Join(dir, value)
+	}
+
+	if file.DB != "" {
+		c.set("db", resolve(file.DB), source)
+	}
+	if file.Workdir != "" {
+		c.set("workdir", resolve(file.Workdir), source)
+	}
+	if file.Workers != 0 {
+		err = c.set("workers", strconv.Itoa(file.Workers), source)
+		if err != nil {
+			return err
+		}
+	}
+	if file.Credentials != "" {
+		c.set("credentials", resolve(file.Credentials), source)
+	}
+	if file.AllowlistPaths != nil {
+		c.AllowlistPaths = file.AllowlistPaths
+		c.sources["allowlist_paths"] = source
+	}
+
+	return nil
+}
+
+// splitGlobalFlags removes the global flags in front of the subcommand from
+// args and returns them by setting name.
+func splitGlobalFlags(args []string) (map[string]string, []string, error) {
+	flags := map[string]string{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[0], "--"), "=")
+		switch name {
+		case "config", "db", "workdir", "workers", "credentials":
+		default:
+			return flags, args, nil
+		}
+
+		if !hasValue {
+			if len(args) < 2 {
+				return nil, nil, fmt.Errorf("flag needs an argument: --%s", name)
+			}
+			value = args[1]
+			args = args[1:]
+		}
+
+		flags[name] = value
+		args = args[1:]
+	}
+
+	return flags, args, nil
+}
+
+// loadConfig builds the config in effect from defaults, config files, the
+// environment and the global flags at the start of args, and returns the
+// remaining arguments.
+func loadConfig(args []string) (config, []string, error) {
+	c := defaultConfig()
+
+	flags, args, err := splitGlobalFlags(args)
+	if err != nil {
+		return c, nil, err
+	}
+
+	configPath, explicit := flags["config"]
+	if !explicit {
+		configPath, explicit = os.LookupEnv(configEnv)
+	}
+
+	if explicit {
+		c.file = expandHome(configPath)
+		err = c.merge(c.file, true)
+		if err != nil {
+			return c, nil, err
+		}
+	} else {
+		userConfigDir, err := os.UserConfigDir()
+		if err == nil {
+			err = c.merge(filepath.Join(userConfigDir, userConfigFilename), false)
+			if err != nil {
+				return c, nil, err
+			}
+		}
+
+		err = c.merge(projectConfigFilename, false)
+		if err != nil {
+			return c, nil, err
+		}
+	}
+
+	envs := map[string]string{
+		"db":          dbEnv,
+		"workdir":     workdirEnv,
+		"workers":     workersEnv,
+		"credentials": credentialsEnv,
+	}
+	for setting, env := range envs {
+		if value, ok := os.LookupEnv(env); ok {
+			err = c.set(setting, expandHome(value), "env "+env)
+			if err != nil {
+				return c, nil, err
+			}
+		}
+	}
+
+	for _, setting := range settings {
+		if value, ok := flags[setting]; ok {
+			err = c.set(setting, expandHome(value), "flag --"+setting)
+			if err != nil {
+				return c, nil, err
+			}
+		}
+	}
+
+	return c, args, nil
+}
+
+// overrides returns the global flags that reproduce the settings taken from
+// the environment or flags, and the always settings wherever they came from,
+// with paths made absolute, for commands that run git-tokens later from
+// elsewhere.
+func (c config) overrides(always ...string) ([]string, error) {
+	args := []string{}
+	if c.file != "" {
+		absolute, err := filepath.Abs(c.file)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--config", absolute)
+	}
+
+	for _, setting := range settings {
+		source := c.sources[setting]
+		overridden := strings.HasPrefix(source, "env ") ||
+			strings.HasPrefix(source, "flag ")
+		if !overridden && !slices.Contains(always, setting) {
+			continue
+		}
+
+		value := c.value(setting)
+		if setting != "workers" {
+			absolute, err := filepath.Abs(value)
+			if err != nil {
+				return nil, err
+			}
+			value = absolute
+		}
+		args = append(args, "--"+setting, value)
+	}
+
+	return args, nil
+}
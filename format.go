@@ -0,0 +1,481 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git-tokens/scanner"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+var findingFormats = []string{"table", "json", "jsonl", "csv", "sarif"}
+
+// findingRecord is the representation of a finding shared by the JSON, JSON
+// Lines and CSV formats.
+type findingRecord struct {
+	ID                   int64  `json:"id"`
+	LastScannedTimestamp string `json:"last_scanned"`
+	Repository           string `json:"repository"`
+	CommitHash           string `json:"commit"`
+	CommitDate           string `json:"commit_date"`
+	AuthorName           string `json:"author_name"`
+	AuthorEmail          string `json:"author_email"`
+	CommitSubject        string `json:"commit_subject"`
+	FileName             string `json:"file"`
+	LineNumber           int    `json:"line"`
+	SecretType           string `json:"secret_type"`
+	Status               string `json:"status"`
+	Assignee             string `json:"assignee"`
+	Note                 string `json:"note"`
+	SecretHash           string `json:"secret_hash"`
+	Content              string `json:"content"`
+}
+
+var findingRecordHeader = []string{
+	"id",
+	"last_scanned",
+	"repository",
+	"commit",
+	"commit_date",
+	"author_name",
+	"author_email",
+	"commit_subject",
+	"file",
+	"line",
+	"secret_type",
+	"status",
+	"assignee",
+	"note",
+	"secret_hash",
+	"content",
+}
+
+func newFindingRecord(finding scanner.Finding) findingRecord {
+	return findingRecord{
+		finding.ID,
+		finding.LastScannedTimestamp.Format(time.RFC3339),
+		finding.Repository,
+		finding.CommitHash,
+		formatCommitDate(finding.CommitTimestamp),
+		finding.AuthorName,
+		finding.AuthorEmail,
+		finding.CommitSubject,
+		finding.FileName,
+		finding.LineNumber,
+		finding.SecretType,
+		string(finding.Status),
+		finding.Assignee,
+		finding.Note,
+		finding.SecretHash,
+		finding.Content,
+	}
+}
+
+func (r findingRecord) fields() []string {
+	return []string{
+		strconv.FormatInt(r.ID, 10),
+		r.LastScannedTimestamp,
+		r.Repository,
+		r.CommitHash,
+		r.CommitDate,
+		r.AuthorName,
+		r.AuthorEmail,
+		r.CommitSubject,
+		r.FileName,
+		strconv.Itoa(r.LineNumber),
+		r.SecretType,
+		r.Status,
+		r.Assignee,
+		r.Note,
+		r.SecretHash,
+		r.Content,
+	}
+}
+
+func writeFindings(
+	w io.Writer,
+	format string,
+	findings []scanner.Finding,
+	secretTypes []scanner.SecretType,
+) error {
+	switch format {
+	case "table":
+		return writeFindingsTable(w, findings)
+	case "json":
+		records := []findingRecord{}
+		for _, finding := range findings {
+			records = append(records, newFindingRecord(finding))
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, finding := range findings {
+			err := encoder.Encode(newFindingRecord(finding))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write(findingRecordHeader)
+		if err != nil {
+			return err
+		}
+		for _, finding := range findings {
+			err := writer.Write(newFindingRecord(finding).fields())
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "sarif":
+		return writeFindingsSARIF(w, findings, secretTypes)
+	default:
+		return fmt.Errorf("unknown output format \"%s\"", format)
+	}
+}
+
+func writeFindingsTable(w io.Writer, findings []scanner.Finding) error {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(
+		writer,
+		"ID\tLAST SCANNED\tREPOSITORY\tCOMMIT\tCOMMIT DATE\tAUTHOR\t"+
+			"FILE\tLINE\tSECRET TYPE\tSTATUS\tCONTENT",
+	)
+	for _, finding := range findings {
+		fmt.Fprintf(
+			writer,
+			"%d\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			finding.ID,
+			finding.LastScannedTimestamp.Format(time.RFC3339),
+			finding.Repository,
+			finding.CommitHash,
+			formatCommitDate(finding.CommitTimestamp),
+			formatAuthor(finding),
+			finding.FileName,
+			finding.LineNumber,
+			finding.SecretType,
+			finding.Status,
+			finding.Content,
+		)
+	}
+
+	return writer.Flush()
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string             `json:"ruleId"`
+	Level               string             `json:"level"`
+	Message             sarifMessage       `json:"message"`
+	Locations           []sarifLocation    `json:"locations"`
+	PartialFingerprints map[string]string  `json:"partialFingerprints"`
+	Suppressions        []sarifSuppression `json:"suppressions,omitempty"`
+	Properties          map[string]string  `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+func sarifLevel(severity string) string {
+	switch severity {
+	case "critical", "high":
+		return "error"
+	case "low", "info":
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// writeFindingsSARIF writes findings as a SARIF 2.1.0 log. Resolved findings
+// are reported as externally suppressed results.
+func writeFindingsSARIF(
+	w io.Writer,
+	findings []scanner.Finding,
+	secretTypes []scanner.SecretType,
+) error {
+	secretTypesByName := map[string]scanner.SecretType{}
+	for _, secretType := range secretTypes {
+		secretTypesByName[secretType.Name] = secretType
+	}
+
+	rules := []sarifRule{}
+	ruleAdded := map[string]bool{}
+	results := []sarifResult{}
+	for _, finding := range findings {
+		secretType := secretTypesByName[finding.SecretType]
+
+		if !ruleAdded[finding.SecretType] {
+			description := secretType.Description
+			if description == "" {
+				description = finding.SecretType
+			}
+			rules = append(rules, sarifRule{
+				finding.SecretType,
+				sarifMessage{description},
+			})
+			ruleAdded[finding.SecretType] = true
+		}
+
+		result := sarifResult{
+			RuleID: finding.SecretType,
+			Level:  sarifLevel(secretType.Severity),
+			Message: sarifMessage{fmt.Sprintf(
+				"Possible %s in commit %s",
+				finding.SecretType,
+				finding.CommitHash,
+			)},
+			Locations: []sarifLocation{{
+				sarifPhysicalLocation{
+					sarifArtifactLocation{finding.FileName},
+					sarifRegion{finding.LineNumber},
+				},
+			}},
+			PartialFingerprints: map[string]string{
+				"findingId":  strconv.FormatInt(finding.ID, 10),
+				"secretHash": finding.SecretHash,
+			},
+			Properties: map[string]string{
+				"repository":    finding.Repository,
+				"commit":        finding.CommitHash,
+				"commitDate":    formatCommitDate(finding.CommitTimestamp),
+				"author":        formatAuthor(finding),
+				"commitSubject": finding.CommitSubject,
+				"status":        string(finding.Status),
+			},
+		}
+		if finding.Status.IsResolved() {
+			result.Suppressions = []sarifSuppression{{
+				"external",
+				finding.Note,
+			}}
+		}
+
+		results = append(results, result)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(sarifLog{
+		sarifSchema,
+		"2.1.0",
+		[]sarifRun{{
+			sarifTool{sarifDriver{"git-tokens", version, rules}},
+			results,
+		}},
+	})
+}
+
+// findingGroupRecord is the representation of a finding group shared by the
+// JSON, JSON Lines and CSV formats.
+type findingGroupRecord struct {
+	LatestID        int64    `json:"latest_id"`
+	Fingerprint     string   `json:"fingerprint"`
+	SecretType      string   `json:"secret_type"`
+	Status          string   `json:"status"`
+	Count           int      `json:"count"`
+	FirstSeenCommit string   `json:"first_seen_commit"`
+	FirstSeenDate   string   `json:"first_seen_date"`
+	LastSeenCommit  string   `json:"last_seen_commit"`
+	LastSeenDate    string   `json:"last_seen_date"`
+	Repositories    []string `json:"repositories"`
+	Content         string   `json:"content"`
+}
+
+var findingGroupRecordHeader = []string{
+	"latest_id",
+	"fingerprint",
+	"secret_type",
+	"status",
+	"count",
+	"first_seen_commit",
+	"first_seen_date",
+	"last_seen_commit",
+	"last_seen_date",
+	"repositories",
+	"content",
+}
+
+func formatCommitDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func newFindingGroupRecord(group scanner.FindingGroup) findingGroupRecord {
+	return findingGroupRecord{
+		group.LatestID,
+		group.Fingerprint,
+		group.SecretType,
+		string(group.Status),
+		group.Count,
+		group.FirstSeen.CommitHash,
+		formatCommitDate(group.FirstSeen.CommitTimestamp),
+		group.LastSeen.CommitHash,
+		formatCommitDate(group.LastSeen.CommitTimestamp),
+		group.Repositories,
+		group.Content,
+	}
+}
+
+func (r findingGroupRecord) fields() []string {
+	return []string{
+		strconv.FormatInt(r.LatestID, 10),
+		r.Fingerprint,
+		r.SecretType,
+		r.Status,
+		strconv.Itoa(r.Count),
+		r.FirstSeenCommit,
+		r.FirstSeenDate,
+		r.LastSeenCommit,
+		r.LastSeenDate,
+		strings.Join(r.Repositories, " "),
+		r.Content,
+	}
+}
+
+func formatAuthor(finding scanner.Finding) string {
+	if finding.AuthorEmail == "" {
+		return finding.AuthorName
+	}
+
+	return fmt.Sprintf("%s <%s>", finding.AuthorName, finding.AuthorEmail)
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+
+	return hash
+}
+
+func writeFindingGroups(
+	w io.Writer,
+	format string,
+	groups []scanner.FindingGroup,
+) error {
+	records := []findingGroupRecord{}
+	for _, group := range groups {
+		records = append(records, newFindingGroupRecord(group))
+	}
+
+	switch format {
+	case "table":
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(
+			writer,
+			"ID\tFINGERPRINT\tSECRET TYPE\tSTATUS\tCOUNT\tFIRST SEEN\tLAST SEEN\tREPOSITORIES\tCONTENT",
+		)
+		for _, record := range records {
+			fmt.Fprintf(
+				writer,
+				"%d\t%s\t%s\t%s\t%d\t%s %s\t%s %s\t%s\t%s\n",
+				record.LatestID,
+				shortHash(record.Fingerprint),
+				record.SecretType,
+				record.Status,
+				record.Count,
+				shortHash(record.FirstSeenCommit),
+				record.FirstSeenDate,
+				shortHash(record.LastSeenCommit),
+				record.LastSeenDate,
+				strings.Join(record.Repositories, ","),
+				record.Content,
+			)
+		}
+		return writer.Flush()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, record := range records {
+			err := encoder.Encode(record)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+		err := writer.Write(findingGroupRecordHeader)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			err := writer.Write(record.fields())
+			if err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("output format \"%s\" does not support grouping", format)
+	}
+}
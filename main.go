@@ -1,9 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"git-tokens/scanner"
@@ -11,14 +16,20 @@ import (
 	"github.com/mitchellh/cli"
 )
 
+const version = "1.0.0"
+
 const (
 	scannerDBType            = "sqlite3"
 	scannerDBFilename        = "git-tokens.sqlite3"
-	scannerWorkingDirectory  = "."
-	scannerRepoDirPattern    = ""
+	scannerWorkingDirectory  = "git-tokens-mirrors"
+	scannerRepoDirPattern    = "*.git"
 	concurrentScannerWorkers = 100
+
+	scannerCredentialsFilename = "git-tokens-credentials.yaml"
 )
 
+// Exit codes are part of the interface scripts rely on, so new ones are
+// only ever appended.
 const (
 	exitSuccess = iota
 	exitMissingSubcommamd
@@ -30,16 +41,60 @@ const (
 	exitScanAllError
 	exitScanRepoError
 	exitFindingListError
+	exitRepoRemoveError
+	exitSecretTypeImportDefaultsError
+	exitSecretTypeImportError
+	exitSecretTypeExportError
+	exitSecretTypeTestError
+	exitSecretTypeRemoveError
+	exitSecretTypeUpdateError
+	exitScanPathError
+	exitFindingResolveError
+	exitFindingIgnoreError
+	exitFindingReopenError
+	exitDBMigrateError
+	exitHookInstallError
+	exitHookRunError
+	exitHookSecretsFound
+	exitConfigError
+	exitBaselineCreateError
+	exitScanSecretsFound
+	exitFindingConfirmError
 )
 
+// currentConfig holds the settings in effect, loaded before any command runs.
+var currentConfig = defaultConfig()
+
 func newScanner() (*scanner.Scanner, error) {
-	return scanner.NewScanner(
+	s, err := scanner.NewScanner(
 		scannerDBType,
-		scannerDBFilename,
-		scannerWorkingDirectory,
+		currentConfig.DB,
+		currentConfig.Workdir,
 		scannerRepoDirPattern,
-		concurrentScannerWorkers,
+		currentConfig.Workers,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.SetAllowedPaths(currentConfig.AllowlistPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsPath := currentConfig.Credentials
+	err = s.LoadCredentials(credentialsPath)
+	if os.IsNotExist(err) && currentConfig.sources["credentials"] == sourceDefault {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf(
+			"could not load credentials from %s: %w",
+			credentialsPath, err,
+		)
+	}
+
+	return s, nil
 }
 
 func confirmRawArgsLenOrLogError(
@@ -58,6 +113,240 @@ func confirmRawArgsLenOrLogError(
 	return true
 }
 
+func newFlagSet(name string, help func() string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		log.Printf("%s\n", help())
+	}
+
+	return flags
+}
+
+// stringsFlag collects the values of a flag that can be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// baselineFlag loads the baseline file named by the --baseline flag when
+// the flag is parsed.
+type baselineFlag struct {
+	path     string
+	baseline scanner.Baseline
+}
+
+func newBaselineFlag(flags *flag.FlagSet, usage string) *baselineFlag {
+	f := &baselineFlag{}
+	flags.Var(f, "baseline", usage)
+
+	return f
+}
+
+func (f *baselineFlag) String() string {
+	return f.path
+}
+
+func (f *baselineFlag) Set(value string) error {
+	baseline, err := scanner.LoadBaseline(value)
+	if err != nil {
+		return fmt.Errorf("could not load baseline %s: %w", value, err)
+	}
+
+	f.path, f.baseline = value, baseline
+	return nil
+}
+
+func failOnFindingsFlag(flags *flag.FlagSet) *bool {
+	return flags.Bool(
+		"fail-on-findings",
+		false,
+		fmt.Sprintf(
+			"exit with %d if secrets not in the baseline are found",
+			exitScanSecretsFound,
+		),
+	)
+}
+
+// scanExitCode is the exit code of a successful scan that found secrets.
+func scanExitCode(failOnFindings bool, found int) int {
+	if failOnFindings && found > 0 {
+		return exitScanSecretsFound
+	}
+
+	return exitSuccess
+}
+
+func parseScanOptions(
+	flags *flag.FlagSet,
+	rawArgs []string,
+) (scanner.ScanOptions, error) {
+	mode := flags.String("mode", "tree", "scan mode, tree or diff")
+	entropy := flags.Bool(
+		"entropy",
+		false,
+		"also report high entropy strings that match no secret type",
+	)
+	showSecrets := flags.Bool(
+		"show-secrets",
+		false,
+		"store the unredacted line along with each finding",
+	)
+	branches := flags.Bool("branches", false, "scan all branches instead of HEAD")
+	tags := flags.Bool("tags", false, "scan all tags instead of HEAD")
+	refs := stringsFlag{}
+	flags.Var(&refs, "refs", "scan refs matching this glob, can be repeated")
+	baseline := newBaselineFlag(
+		flags,
+		"store but do not count the secrets listed in this baseline file",
+	)
+
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		return scanner.ScanOptions{}, err
+	}
+
+	scanMode, err := scanner.ParseScanMode(*mode)
+	if err != nil {
+		return scanner.ScanOptions{}, err
+	}
+
+	return scanner.ScanOptions{
+		Mode:        scanMode,
+		Entropy:     *entropy,
+		ShowSecrets: *showSecrets,
+		Branches:    *branches,
+		Tags:        *tags,
+		Refs:        refs,
+		Baseline:    baseline.baseline,
+	}, nil
+}
+
+// parseTime accepts a date, an RFC 3339 timestamp or a duration before now
+// such as "36h" or "7d".
+func parseTime(value string) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return time.Now().Add(-duration), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time \"%s\"", value)
+}
+
+func parseFindingQuery(
+	flags *flag.FlagSet,
+	rawArgs []string,
+) (scanner.FindingQuery, error) {
+	query := scanner.FindingQuery{}
+	flags.StringVar(&query.Repository, "repo", "", "only findings of this repo")
+	flags.StringVar(
+		&query.SecretType,
+		"secret-type",
+		"",
+		"only findings of this secret type",
+	)
+	flags.StringVar(
+		&query.FileGlob,
+		"file",
+		"",
+		"only files matching this SQLite GLOB, where * also matches /",
+	)
+	statuses := flags.String(
+		"status",
+		"",
+		"comma separated statuses, defaults to open,confirmed",
+	)
+	all := flags.Bool("all", false, "also list resolved and ignored findings")
+	since := flags.String("since", "", "only findings last scanned since then")
+	until := flags.String("until", "", "only findings last scanned before then")
+	committedSince := flags.String(
+		"committed-since",
+		"",
+		"only findings in commits dated since then",
+	)
+	committedUntil := flags.String(
+		"committed-until",
+		"",
+		"only findings in commits dated before then",
+	)
+	flags.StringVar(
+		&query.SortBy,
+		"sort",
+		"id",
+		"sort by "+strings.Join(scanner.FindingSortKeys(), ", "),
+	)
+	flags.BoolVar(&query.Descending, "desc", false, "sort in descending order")
+	flags.IntVar(&query.Limit, "limit", 0, "list at most this many findings")
+	flags.IntVar(&query.Offset, "offset", 0, "skip this many findings")
+
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		return scanner.FindingQuery{}, err
+	}
+
+	switch {
+	case *statuses != "":
+		for _, rawStatus := range strings.Split(*statuses, ",") {
+			status, err := scanner.ParseFindingStatus(strings.TrimSpace(rawStatus))
+			if err != nil {
+				return scanner.FindingQuery{}, err
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	case !*all:
+		query.Statuses = []scanner.FindingStatus{
+			scanner.StatusOpen,
+			scanner.StatusConfirmed,
+		}
+	}
+
+	if *since != "" {
+		query.Since, err = parseTime(*since)
+		if err != nil {
+			return scanner.FindingQuery{}, err
+		}
+	}
+	if *until != "" {
+		query.Until, err = parseTime(*until)
+		if err != nil {
+			return scanner.FindingQuery{}, err
+		}
+	}
+	if *committedSince != "" {
+		query.CommittedSince, err = parseTime(*committedSince)
+		if err != nil {
+			return scanner.FindingQuery{}, err
+		}
+	}
+	if *committedUntil != "" {
+		query.CommittedUntil, err = parseTime(*committedUntil)
+		if err != nil {
+			return scanner.FindingQuery{}, err
+		}
+	}
+
+	return query, nil
+}
+
 type repoCommand struct{}
 
 func (c repoCommand) Run(rawArgs []string) int {
@@ -70,7 +359,7 @@ func (c repoCommand) Run(rawArgs []string) int {
 }
 
 func (c repoCommand) Help() string {
-	return "Usage: git-tokens repo [add | list]"
+	return "Usage: git-tokens repo [add | list | remove]"
 }
 
 func (c repoCommand) Synopsis() string {
@@ -102,7 +391,7 @@ func (c repoAddCommand) Run(rawArgs []string) int {
 }
 
 func (c repoAddCommand) Help() string {
-	return "Usage: git-tokens repo add <repo-url>"
+	return "Usage: git-tokens repo add <repo-url | path>"
 }
 
 func (c repoAddCommand) Synopsis() string {
@@ -143,6 +432,50 @@ func (c repoListCommand) Synopsis() string {
 	return "List all repos in database"
 }
 
+type repoRemoveCommand struct{}
+
+func (c repoRemoveCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("repo remove", c.Help)
+	purge := flags.Bool(
+		"purge",
+		false,
+		"also delete scanned commits and findings of the repo",
+	)
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitRepoRemoveError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 1, c.Help) {
+		return exitRepoRemoveError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	repoUrl := flags.Arg(0)
+	log.Printf("Removing repo %s\n", repoUrl)
+	err = scanner.RemoveRepo(repoUrl, *purge)
+	if err != nil {
+		log.Printf("Could not remove repo: %s\n", err)
+		return exitRepoRemoveError
+	}
+
+	return exitSuccess
+}
+
+func (c repoRemoveCommand) Help() string {
+	return "Usage: git-tokens repo remove [--purge] <repo-url>"
+}
+
+func (c repoRemoveCommand) Synopsis() string {
+	return "Remove repository from database"
+}
+
 type secretTypeCommand struct{}
 
 func (c secretTypeCommand) Run(rawArgs []string) int {
@@ -155,7 +488,7 @@ func (c secretTypeCommand) Run(rawArgs []string) int {
 }
 
 func (c secretTypeCommand) Help() string {
-	return "git-tokens secret-type [add | list]"
+	return "git-tokens secret-type [add | list | remove | update | import-defaults | import | export | test]"
 }
 
 func (c secretTypeCommand) Synopsis() string {
@@ -215,7 +548,14 @@ func (c secretTypeListCommand) Run(rawArgs []string) int {
 	}
 
 	for _, secretType := range secretTypes {
-		fmt.Printf("%s\t%s\n", secretType.Name, secretType.Regex)
+		fmt.Printf(
+			"%s\t%s\t%d\t%s\t%s\n",
+			secretType.Name,
+			secretType.Regex,
+			secretType.Version,
+			secretType.Severity,
+			secretType.Description,
+		)
 	}
 
 	return exitSuccess
@@ -229,61 +569,79 @@ func (c secretTypeListCommand) Synopsis() string {
 	return "List all secret types in databas"
 }
 
-type scanCommand struct{}
+type secretTypeRemoveCommand struct{}
 
-func (c scanCommand) Run(rawArgs []string) int {
-	fmt.Printf(
-		"Missing subcommand\n%s\n",
-		c.Help(),
-	)
+func (c secretTypeRemoveCommand) Run(rawArgs []string) int {
+	if !confirmRawArgsLenOrLogError(rawArgs, 1, c.Help) {
+		return exitSecretTypeRemoveError
+	}
 
-	return exitMissingSubcommamd
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	secretTypeName := rawArgs[0]
+	log.Printf("Removing secret type \"%s\"\n", secretTypeName)
+	err = scanner.RemoveSecretType(secretTypeName)
+	if err != nil {
+		log.Printf("Could not remove secret type: %s\n", err)
+		return exitSecretTypeRemoveError
+	}
+
+	return exitSuccess
 }
 
-func (c scanCommand) Help() string {
-	return "Usage: git-secrets scan [all | repo]"
+func (c secretTypeRemoveCommand) Help() string {
+	return "Usage: git-tokens secret-type remove <secret type name>"
 }
 
-func (c scanCommand) Synopsis() string {
-	return "Scan all or a single repo"
+func (c secretTypeRemoveCommand) Synopsis() string {
+	return "Remove secret type from database"
 }
 
-type scanAllCommand struct{}
+type secretTypeUpdateCommand struct{}
 
-func (c scanAllCommand) Run(rawArgs []string) int {
-	if !confirmRawArgsLenOrLogError(rawArgs, 0, c.Help) {
-		return exitScanAllError
+func (c secretTypeUpdateCommand) Run(rawArgs []string) int {
+	if !confirmRawArgsLenOrLogError(rawArgs, 2, c.Help) {
+		return exitSecretTypeUpdateError
 	}
 
 	scanner, err := newScanner()
 	if err != nil {
-		log.Printf("Could not create new scanner: %s\n", err)
+		log.Printf("Could not create new scanner, %s\n", err)
 		return exitNewScannerError
 	}
 
-	log.Printf("Scanning all repos\n")
-	err = scanner.ScanAll()
+	secretTypeName := rawArgs[0]
+	secretTypeRegex := rawArgs[1]
+	log.Printf(
+		"Updating secret type \"%s\": \"%s\"",
+		secretTypeName, secretTypeRegex,
+	)
+	err = scanner.UpdateSecretType(secretTypeName, secretTypeRegex)
 	if err != nil {
-		log.Printf("Could not scan repos: %s\n", err)
-		return exitScanAllError
+		log.Printf("Could not update secret type: %s\n", err)
+		return exitSecretTypeUpdateError
 	}
 
 	return exitSuccess
 }
 
-func (c scanAllCommand) Help() string {
-	return "Usage: git-secrets scan all"
+func (c secretTypeUpdateCommand) Help() string {
+	return "Usage: git-tokens secret-type update <secret type name> <secret type regex>"
 }
 
-func (c scanAllCommand) Synopsis() string {
-	return "Scan all new commits in all repos"
+func (c secretTypeUpdateCommand) Synopsis() string {
+	return "Change the regex of a secret type and rescan it on the next scan"
 }
 
-type scanRepoCommand struct{}
+type secretTypeImportDefaultsCommand struct{}
 
-func (c scanRepoCommand) Run(rawArgs []string) int {
-	if !confirmRawArgsLenOrLogError(rawArgs, 1, c.Help) {
-		return exitScanRepoError
+func (c secretTypeImportDefaultsCommand) Run(rawArgs []string) int {
+	if !confirmRawArgsLenOrLogError(rawArgs, 0, c.Help) {
+		return exitSecretTypeImportDefaultsError
 	}
 
 	scanner, err := newScanner()
@@ -292,48 +650,76 @@ func (c scanRepoCommand) Run(rawArgs []string) int {
 		return exitNewScannerError
 	}
 
-	repoUrl := rawArgs[0]
-	err = scanner.ScanSingleRepo(repoUrl)
+	imported, err := scanner.ImportDefaultSecretTypes()
 	if err != nil {
-		log.Printf("Could not scan repo %s: %s\n", repoUrl, err)
-		return exitScanRepoError
+		log.Printf("Could not import default secret types: %s\n", err)
+		return exitSecretTypeImportDefaultsError
 	}
+	log.Printf("Added or updated %d secret types\n", imported)
 
 	return exitSuccess
 }
 
-func (c scanRepoCommand) Help() string {
-	return "Usage: git-tokens scan repo <repo url>"
+func (c secretTypeImportDefaultsCommand) Help() string {
+	return "Usage: git-tokens secret-type import-defaults"
 }
 
-func (c scanRepoCommand) Synopsis() string {
-	return "Scan single repository"
+func (c secretTypeImportDefaultsCommand) Synopsis() string {
+	return "Add or update the built-in secret types"
 }
 
-type findingCommand struct{}
+type secretTypeImportCommand struct{}
 
-func (c findingCommand) Run(rawArgs []string) int {
-	fmt.Printf(
-		"Missing subcommand\n%s\n",
-		c.Help(),
-	)
+func (c secretTypeImportCommand) Run(rawArgs []string) int {
+	if !confirmRawArgsLenOrLogError(rawArgs, 1, c.Help) {
+		return exitSecretTypeImportError
+	}
 
-	return exitMissingSubcommamd
+	path := rawArgs[0]
+	secretTypes, err := scanner.ReadSecretTypesFile(path)
+	if err != nil {
+		log.Printf("Could not read rule file %s: %s\n", path, err)
+		return exitSecretTypeImportError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	imported, err := scanner.ImportSecretTypes(secretTypes, true)
+	if err != nil {
+		log.Printf("Could not import secret types: %s\n", err)
+		return exitSecretTypeImportError
+	}
+	log.Printf("Added or updated %d secret types from %s\n", imported, path)
+
+	return exitSuccess
 }
 
-func (c findingCommand) Help() string {
-	return "Usage: git-tokens finding [list]"
+func (c secretTypeImportCommand) Help() string {
+	return "Usage: git-tokens secret-type import <rule file (.yaml, .yml, .toml)>"
 }
 
-func (c findingCommand) Synopsis() string {
-	return "Manage findings"
+func (c secretTypeImportCommand) Synopsis() string {
+	return "Import secret types from a YAML, TOML or gitleaks rule file"
 }
 
-type findingListCommand struct{}
+type secretTypeExportCommand struct{}
 
-func (c findingListCommand) Run(rawArgs []string) int {
-	if !confirmRawArgsLenOrLogError(rawArgs, 0, c.Help) {
-		return exitFindingListError
+func (c secretTypeExportCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("secret-type export", c.Help)
+	format := flags.String("format", "yaml", "rule file format, yaml or toml")
+	output := flags.String("output", "", "file to write instead of stdout")
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitSecretTypeExportError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 0, c.Help) {
+		return exitSecretTypeExportError
 	}
 
 	scanner, err := newScanner()
@@ -342,86 +728,1153 @@ func (c findingListCommand) Run(rawArgs []string) int {
 		return exitNewScannerError
 	}
 
-	findings, err := scanner.GetFindings()
-	if err != nil {
-		log.Printf("Could not get findings: %s\n", err)
-		return exitFindingListError
+	w := os.Stdout
+	if *output != "" {
+		w, err = os.Create(*output)
+		if err != nil {
+			log.Printf("Could not create %s: %s\n", *output, err)
+			return exitSecretTypeExportError
+		}
+		defer w.Close()
 	}
 
-	for _, finding := range findings {
-		fmt.Printf(
-			"%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
-			finding.LastScannedTimestamp.Format(time.RFC822Z),
-			finding.FileName,
-			finding.LineNumber,
-			finding.Content,
-			finding.TreeName,
-			finding.Repository,
-			finding.SecretType,
-		)
+	err = scanner.ExportSecretTypes(w, *format)
+	if err != nil {
+		log.Printf("Could not export secret types: %s\n", err)
+		return exitSecretTypeExportError
 	}
 
 	return exitSuccess
 }
 
-func (c findingListCommand) Help() string {
-	return "Usage: git-tokens finding list"
+func (c secretTypeExportCommand) Help() string {
+	return "Usage: git-tokens secret-type export [--format yaml|toml] [--output <file>]"
 }
 
-func (c findingListCommand) Synopsis() string {
-	return "List all findings"
+func (c secretTypeExportCommand) Synopsis() string {
+	return "Export secret types to a YAML or TOML rule file"
 }
 
-func main() {
-	c := cli.NewCLI("git-token", "1.0.0")
-	c.Args = os.Args[1:]
-	c.Commands = map[string]cli.CommandFactory{
-		"repo": func() (cli.Command, error) {
-			return repoCommand{}, nil
-		},
+type secretTypeTestCommand struct{}
 
-		"repo add": func() (cli.Command, error) {
-			return repoAddCommand{}, nil
-		},
+func (c secretTypeTestCommand) Run(rawArgs []string) int {
+	if !confirmRawArgsLenOrLogError(rawArgs, 2, c.Help) {
+		return exitSecretTypeTestError
+	}
 
-		// TODO: Add "repo remove"
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
 
-		"repo list": func() (cli.Command, error) {
-			return repoListCommand{}, nil
-		},
+	secretTypeName := rawArgs[0]
+	sample := rawArgs[1]
+	matches, err := scanner.TestSecretType(secretTypeName, sample)
+	if err != nil {
+		log.Printf("Could not test secret type: %s\n", err)
+		return exitSecretTypeTestError
+	}
 
-		"secret-type": func() (cli.Command, error) {
-			return secretTypeCommand{}, nil
-		},
+	if len(matches) == 0 {
+		fmt.Println("No match")
+	}
 
-		"secret-type add": func() (cli.Command, error) {
-			return secretTypeAddCommand{}, nil
-		},
+	for _, match := range matches {
+		status := "match"
+		if match.Suppressed != "" {
+			status = "suppressed: " + match.Suppressed
+		}
+		fmt.Printf("%s\t%.2f\t%s\n", match.Secret, match.Entropy, status)
+	}
 
-		// TODO: Add "secret-type remove"
+	return exitSuccess
+}
 
-		"secret-type list": func() (cli.Command, error) {
-			return secretTypeListCommand{}, nil
-		},
+func (c secretTypeTestCommand) Help() string {
+	return "Usage: git-tokens secret-type test <secret type name> <sample text>"
+}
 
-		"scan": func() (cli.Command, error) {
-			return scanCommand{}, nil
-		},
+func (c secretTypeTestCommand) Synopsis() string {
+	return "Test a secret type against sample text"
+}
 
-		"scan all": func() (cli.Command, error) {
-			return scanAllCommand{}, nil
-		},
+// logScanSummary logs the counts of a scan. Suppressed matches only show up
+// here, they are not stored as findings.
+func logScanSummary(summary scanner.ScanSummary) {
+	suppressed := 0
+	reasons := []string{}
+	for _, reason := range scanner.SuppressionReasons {
+		suppressed += summary.Suppressed[reason]
+		reasons = append(
+			reasons,
+			fmt.Sprintf("%s: %d", reason, summary.Suppressed[reason]),
+		)
+	}
 
-		"scan repo": func() (cli.Command, error) {
-			return scanRepoCommand{}, nil
-		},
+	log.Printf(
+		"Scanned %d commits and %d new blobs, found %d secrets, "+
+			"suppressed %d (%s)\n",
+		summary.Commits,
+		summary.Blobs,
+		summary.Findings,
+		suppressed,
+		strings.Join(reasons, ", "),
+	)
 
-		"finding": func() (cli.Command, error) {
-			return findingCommand{}, nil
-		},
+	if summary.Failed > 0 {
+		log.Printf(
+			"Could not scan %d commits, the next scan retries them\n",
+			summary.Failed,
+		)
+	}
+}
 
-		"finding list": func() (cli.Command, error) {
-			return findingListCommand{}, nil
+type scanCommand struct{}
+
+func (c scanCommand) Run(rawArgs []string) int {
+	fmt.Printf(
+		"Missing subcommand\n%s\n",
+		c.Help(),
+	)
+
+	return exitMissingSubcommamd
+}
+
+func (c scanCommand) Help() string {
+	return "Usage: git-secrets scan [all | repo | path]"
+}
+
+func (c scanCommand) Synopsis() string {
+	return "Scan all or a single repo"
+}
+
+type scanAllCommand struct{}
+
+func (c scanAllCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("scan all", c.Help)
+	failOnFindings := failOnFindingsFlag(flags)
+	options, err := parseScanOptions(flags, rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitScanAllError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 0, c.Help) {
+		return exitScanAllError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner: %s\n", err)
+		return exitNewScannerError
+	}
+
+	log.Printf("Scanning all repos in %s mode\n", options.Mode)
+	summary, err := scanner.ScanAll(options)
+	logScanSummary(summary)
+	if err != nil {
+		log.Printf("Could not scan repos: %s\n", err)
+		return exitScanAllError
+	}
+
+	return scanExitCode(*failOnFindings, summary.Findings)
+}
+
+func (c scanAllCommand) Help() string {
+	return "Usage: git-secrets scan all [--mode tree|diff] [--entropy] " +
+		"[--show-secrets] [--branches] [--tags] [--refs glob]... " +
+		"[--baseline file] [--fail-on-findings]"
+}
+
+func (c scanAllCommand) Synopsis() string {
+	return "Scan all new commits in all repos"
+}
+
+type scanRepoCommand struct{}
+
+func (c scanRepoCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("scan repo", c.Help)
+	failOnFindings := failOnFindingsFlag(flags)
+	options, err := parseScanOptions(flags, rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitScanRepoError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 1, c.Help) {
+		return exitScanRepoError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	repoUrl := flags.Arg(0)
+	summary, err := scanner.ScanSingleRepo(repoUrl, options)
+	logScanSummary(summary)
+	if err != nil {
+		log.Printf("Could not scan repo %s: %s\n", repoUrl, err)
+		return exitScanRepoError
+	}
+
+	return scanExitCode(*failOnFindings, summary.Findings)
+}
+
+func (c scanRepoCommand) Help() string {
+	return "Usage: git-tokens scan repo [--mode tree|diff] [--entropy] " +
+		"[--show-secrets] [--branches] [--tags] [--refs glob]... " +
+		"[--baseline file] [--fail-on-findings] <repo url>"
+}
+
+func (c scanRepoCommand) Synopsis() string {
+	return "Scan single repository"
+}
+
+type scanPathCommand struct{}
+
+func (c scanPathCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("scan path", c.Help)
+	format := flags.String("format", "table", "output format")
+	failOnFindings := failOnFindingsFlag(flags)
+	options, err := parseScanOptions(flags, rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitScanPathError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 1, c.Help) {
+		return exitScanPathError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	path := flags.Arg(0)
+	findings, summary, err := scanner.ScanPath(path, options)
+	if err != nil {
+		log.Printf("Could not scan path %s: %s\n", path, err)
+		return exitScanPathError
+	}
+	logScanSummary(summary)
+
+	secretTypes, err := scanner.GetSecretTypes()
+	if err != nil {
+		log.Printf("Could not get secret types: %s\n", err)
+		return exitScanPathError
+	}
+
+	if options.ShowSecrets {
+		for i, finding := range findings {
+			findings[i].Content = finding.RawContent
+		}
+	}
+
+	log.Printf(
+		"Found %d secrets in uncommitted files, "+
+			"see finding list --repo for committed ones\n",
+		len(findings),
+	)
+	err = writeFindings(os.Stdout, *format, findings, secretTypes)
+	if err != nil {
+		log.Printf("Could not write findings: %s\n", err)
+		return exitScanPathError
+	}
+
+	return scanExitCode(*failOnFindings, summary.Findings+len(findings))
+}
+
+func (c scanPathCommand) Help() string {
+	return "Usage: git-tokens scan path [--mode tree|diff] [--entropy] " +
+		"[--show-secrets] [--branches] [--tags] [--refs glob]... " +
+		"[--baseline file] [--fail-on-findings] " +
+		"[--format " + strings.Join(findingFormats, "|") + "] <dir>"
+}
+
+func (c scanPathCommand) Synopsis() string {
+	return "Scan a local checkout including uncommitted and untracked files"
+}
+
+type findingCommand struct{}
+
+func (c findingCommand) Run(rawArgs []string) int {
+	fmt.Printf(
+		"Missing subcommand\n%s\n",
+		c.Help(),
+	)
+
+	return exitMissingSubcommamd
+}
+
+func (c findingCommand) Help() string {
+	return "Usage: git-tokens finding " +
+		"[list | confirm | resolve | ignore | reopen]"
+}
+
+func (c findingCommand) Synopsis() string {
+	return "Manage findings"
+}
+
+type findingListCommand struct{}
+
+func (c findingListCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("finding list", c.Help)
+	format := flags.String("format", "table", "output format")
+	grouped := flags.Bool("grouped", false, "list one row per distinct secret")
+	showSecrets := flags.Bool(
+		"show-secrets",
+		false,
+		"show unredacted lines of findings scanned with --show-secrets",
+	)
+	query, err := parseFindingQuery(flags, rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitFindingListError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 0, c.Help) {
+		return exitFindingListError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	if *grouped {
+		groups, err := scanner.GroupFindings(query)
+		if err != nil {
+			log.Printf("Could not get findings: %s\n", err)
+			return exitFindingListError
+		}
+
+		if *showSecrets {
+			for i, group := range groups {
+				if group.FirstSeen.RawContent != "" {
+					groups[i].Content = group.FirstSeen.RawContent
+				}
+			}
+		}
+
+		err = writeFindingGroups(os.Stdout, *format, groups)
+		if err != nil {
+			log.Printf("Could not write findings: %s\n", err)
+			return exitFindingListError
+		}
+
+		return exitSuccess
+	}
+
+	findings, err := scanner.QueryFindings(query)
+	if err != nil {
+		log.Printf("Could not get findings: %s\n", err)
+		return exitFindingListError
+	}
+
+	if *showSecrets {
+		for i, finding := range findings {
+			if finding.RawContent != "" {
+				findings[i].Content = finding.RawContent
+			}
+		}
+	}
+
+	secretTypes, err := scanner.GetSecretTypes()
+	if err != nil {
+		log.Printf("Could not get secret types: %s\n", err)
+		return exitFindingListError
+	}
+
+	err = writeFindings(os.Stdout, *format, findings, secretTypes)
+	if err != nil {
+		log.Printf("Could not write findings: %s\n", err)
+		return exitFindingListError
+	}
+
+	return exitSuccess
+}
+
+func (c findingListCommand) Help() string {
+	return "Usage: git-tokens finding list [--repo url] [--secret-type name] " +
+		"[--file glob] [--status status,...] [--all] " +
+		"[--since time] [--until time] " +
+		"[--committed-since time] [--committed-until time] " +
+		"[--sort key] [--desc] " +
+		"[--limit n] [--offset n] [--grouped] [--show-secrets] " +
+		"[--format " + strings.Join(findingFormats, "|") + "]\n\n" +
+		"--since and --until filter on when a finding was last scanned, " +
+		"--committed-since and --committed-until on the date of its commit. " +
+		"Times are dates, RFC 3339 timestamps or durations before now " +
+		"such as 36h or 7d.\n\n" +
+		"--file uses SQLite GLOB syntax, unlike the globs of " +
+		"allowlist_paths: it is case sensitive and * also matches /, " +
+		"so *.env matches config/.env."
+}
+
+func (c findingListCommand) Synopsis() string {
+	return "List open and confirmed findings"
+}
+
+func parseFindingID(rawID string) (int64, error) {
+	ID, err := strconv.ParseInt(rawID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid finding id \"%s\"", rawID)
+	}
+
+	return ID, nil
+}
+
+// setFindingStatus parses the shared flags of the finding confirm, resolve,
+// ignore and reopen commands and applies the resulting status.
+func setFindingStatus(
+	name string,
+	rawArgs []string,
+	help func() string,
+	statusFlag string,
+	defaultStatus scanner.FindingStatus,
+	allowedStatuses ...scanner.FindingStatus,
+) error {
+	flags := newFlagSet(name, help)
+	rawStatus := string(defaultStatus)
+	if statusFlag != "" {
+		flags.StringVar(&rawStatus, statusFlag, rawStatus, "new status")
+	}
+	group := flags.Bool("group", false, "update all findings of the same secret")
+	assignee := flags.String("assignee", "", "who handles the finding")
+	note := flags.String("note", "", "free form note")
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		return err
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 1, help) {
+		return fmt.Errorf("wrong number of arguments")
+	}
+
+	ID, err := parseFindingID(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	status, err := scanner.ParseFindingStatus(rawStatus)
+	if err != nil {
+		return err
+	}
+
+	allowed := false
+	for _, allowedStatus := range allowedStatuses {
+		allowed = allowed || status == allowedStatus
+	}
+	if !allowed {
+		return fmt.Errorf("status \"%s\" is not allowed here", status)
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		return err
+	}
+
+	return scanner.SetFindingStatus(ID, *group, status, *assignee, *note)
+}
+
+type findingResolveCommand struct{}
+
+func (c findingResolveCommand) Run(rawArgs []string) int {
+	err := setFindingStatus(
+		"finding resolve",
+		rawArgs,
+		c.Help,
+		"status",
+		scanner.StatusRevoked,
+		scanner.StatusRevoked,
+	)
+	if err != nil {
+		log.Printf("Could not resolve finding: %s\n", err)
+		return exitFindingResolveError
+	}
+
+	return exitSuccess
+}
+
+func (c findingResolveCommand) Help() string {
+	return "Usage: git-tokens finding resolve " +
+		"[--status revoked] [--group] [--assignee name] " +
+		"[--note text] <id>"
+}
+
+func (c findingResolveCommand) Synopsis() string {
+	return "Mark a finding as revoked"
+}
+
+type findingConfirmCommand struct{}
+
+func (c findingConfirmCommand) Run(rawArgs []string) int {
+	err := setFindingStatus(
+		"finding confirm",
+		rawArgs,
+		c.Help,
+		"",
+		scanner.StatusConfirmed,
+		scanner.StatusConfirmed,
+	)
+	if err != nil {
+		log.Printf("Could not confirm finding: %s\n", err)
+		return exitFindingConfirmError
+	}
+
+	return exitSuccess
+}
+
+func (c findingConfirmCommand) Help() string {
+	return "Usage: git-tokens finding confirm [--group] [--assignee name] " +
+		"[--note text] <id>\n\n" +
+		"Confirmed findings are real secrets that are not revoked yet, " +
+		"they stay open until resolved."
+}
+
+func (c findingConfirmCommand) Synopsis() string {
+	return "Mark a finding as a real secret that still needs revoking"
+}
+
+type findingIgnoreCommand struct{}
+
+func (c findingIgnoreCommand) Run(rawArgs []string) int {
+	err := setFindingStatus(
+		"finding ignore",
+		rawArgs,
+		c.Help,
+		"reason",
+		scanner.StatusFalsePositive,
+		scanner.StatusFalsePositive,
+		scanner.StatusAcceptedRisk,
+	)
+	if err != nil {
+		log.Printf("Could not ignore finding: %s\n", err)
+		return exitFindingIgnoreError
+	}
+
+	return exitSuccess
+}
+
+func (c findingIgnoreCommand) Help() string {
+	return "Usage: git-tokens finding ignore " +
+		"[--reason false-positive|accepted-risk] [--group] [--assignee name] " +
+		"[--note text] <id>"
+}
+
+func (c findingIgnoreCommand) Synopsis() string {
+	return "Mark a finding as a false positive or an accepted risk"
+}
+
+type findingReopenCommand struct{}
+
+func (c findingReopenCommand) Run(rawArgs []string) int {
+	err := setFindingStatus(
+		"finding reopen",
+		rawArgs,
+		c.Help,
+		"",
+		scanner.StatusOpen,
+		scanner.StatusOpen,
+	)
+	if err != nil {
+		log.Printf("Could not reopen finding: %s\n", err)
+		return exitFindingReopenError
+	}
+
+	return exitSuccess
+}
+
+func (c findingReopenCommand) Help() string {
+	return "Usage: git-tokens finding reopen [--group] [--assignee name] " +
+		"[--note text] <id>"
+}
+
+func (c findingReopenCommand) Synopsis() string {
+	return "Reopen a resolved or ignored finding"
+}
+
+type dbCommand struct{}
+
+func (c dbCommand) Run(rawArgs []string) int {
+	fmt.Printf(
+		"Missing subcommand\n%s\n",
+		c.Help(),
+	)
+
+	return exitMissingSubcommamd
+}
+
+func (c dbCommand) Help() string {
+	return "Usage: git-tokens db [migrate]"
+}
+
+func (c dbCommand) Synopsis() string {
+	return "Manage the database"
+}
+
+type dbMigrateCommand struct{}
+
+func (c dbMigrateCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("db migrate", c.Help)
+	dryRun := flags.Bool("dry-run", false, "only print pending migrations")
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitDBMigrateError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 0, c.Help) {
+		return exitDBMigrateError
+	}
+
+	if *dryRun {
+		migrations, err := scanner.PendingMigrations(
+			scannerDBType,
+			currentConfig.DB,
+		)
+		if err != nil {
+			log.Printf("Could not get pending migrations: %s\n", err)
+			return exitDBMigrateError
+		}
+
+		for _, migration := range migrations {
+			fmt.Printf("%d\t%s\n", migration.Version, migration.Description)
+		}
+
+		return exitSuccess
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	version, err := scanner.SchemaVersion()
+	if err != nil {
+		log.Printf("Could not get schema version: %s\n", err)
+		return exitDBMigrateError
+	}
+	log.Printf("Database is at schema version %d\n", version)
+
+	return exitSuccess
+}
+
+func (c dbMigrateCommand) Help() string {
+	return "Usage: git-tokens db migrate [--dry-run]"
+}
+
+func (c dbMigrateCommand) Synopsis() string {
+	return "Apply pending database migrations"
+}
+
+type hookCommand struct{}
+
+func (c hookCommand) Run(rawArgs []string) int {
+	fmt.Printf(
+		"Missing subcommand\n%s\n",
+		c.Help(),
+	)
+
+	return exitMissingSubcommamd
+}
+
+func (c hookCommand) Help() string {
+	return "Usage: git-tokens hook [install | run]"
+}
+
+func (c hookCommand) Synopsis() string {
+	return "Manage git hooks"
+}
+
+type hookInstallCommand struct{}
+
+func (c hookInstallCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("hook install", c.Help)
+	force := flags.Bool("force", false, "replace existing hooks")
+	baseline := newBaselineFlag(
+		flags,
+		"suppress the secrets listed in this baseline file",
+	)
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitHookInstallError
+	}
+
+	path := "."
+	if flags.NArg() > 0 {
+		if !confirmRawArgsLenOrLogError(flags.Args(), 1, c.Help) {
+			return exitHookInstallError
+		}
+		path = flags.Arg(0)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Printf("Could not find git-tokens executable: %s\n", err)
+		return exitHookInstallError
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		log.Printf("Could not get working directory: %s\n", err)
+		return exitHookInstallError
+	}
+
+	err = checkHookDB()
+	if err != nil {
+		log.Printf("Could not install hooks: %s\n", err)
+		return exitHookInstallError
+	}
+
+	overrides, err := currentConfig.overrides("db")
+	if err != nil {
+		log.Printf("Could not resolve settings: %s\n", err)
+		return exitHookInstallError
+	}
+
+	runFlags := []string{}
+	if baseline.path != "" {
+		absolute, err := filepath.Abs(baseline.path)
+		if err != nil {
+			log.Printf("Could not resolve baseline path: %s\n", err)
+			return exitHookInstallError
+		}
+		runFlags = append(runFlags, "--baseline", absolute)
+	}
+
+	command := append([]string{executable}, overrides...)
+	err = scanner.InstallHooks(path, dir, command, runFlags, *force)
+	if err != nil {
+		log.Printf("Could not install hooks: %s\n", err)
+		return exitHookInstallError
+	}
+
+	return exitSuccess
+}
+
+func (c hookInstallCommand) Help() string {
+	return "Usage: git-tokens hook install [--force] [--baseline file] " +
+		"[repo path]\n\n" +
+		"The hooks run from the current directory with the settings in " +
+		"effect, so they use the same database and config files. The " +
+		"database must exist and have secret types."
+}
+
+// checkHookDB makes sure the database hooks check changes against exists
+// and has secret types, so hooks neither create an empty database nor let
+// every change pass.
+func checkHookDB() error {
+	_, err := os.Stat(currentConfig.DB)
+	if err != nil {
+		return fmt.Errorf("could not open database: %w", err)
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		return err
+	}
+
+	secretTypes, err := scanner.GetSecretTypes()
+	if err != nil {
+		return err
+	}
+
+	if len(secretTypes) == 0 {
+		return fmt.Errorf(
+			"no secret types in %s, add them with secret-type import-defaults",
+			currentConfig.DB,
+		)
+	}
+
+	return nil
+}
+
+func (c hookInstallCommand) Synopsis() string {
+	return "Install pre-commit and pre-push hooks into a repository"
+}
+
+type hookRunCommand struct{}
+
+func (c hookRunCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("hook run", c.Help)
+	baseline := newBaselineFlag(
+		flags,
+		"suppress the secrets listed in this baseline file",
+	)
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitHookRunError
+	}
+
+	args := flags.Args()
+	if len(args) < 2 {
+		log.Printf("Wrong number of arguments\n%s\n", c.Help())
+		return exitHookRunError
+	}
+
+	hook, path := args[0], args[1]
+	if hook != scanner.HookPreCommit && hook != scanner.HookPrePush {
+		log.Printf("Unknown hook %s\n%s\n", hook, c.Help())
+		return exitHookRunError
+	}
+
+	_, err = os.Stat(currentConfig.DB)
+	if err != nil {
+		log.Printf("Could not run %s hook: %s\n", hook, err)
+		return exitHookRunError
+	}
+
+	preCommit := hook == scanner.HookPreCommit
+	var findings []scanner.Finding
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	if preCommit {
+		findings, err = scanner.CheckStaged(path, baseline.baseline)
+	} else {
+		findings, err = scanner.CheckPush(path, os.Stdin, baseline.baseline)
+	}
+	if err != nil {
+		log.Printf("Could not run %s hook: %s\n", hook, err)
+		return exitHookRunError
+	}
+
+	if len(findings) == 0 {
+		return exitSuccess
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"git-tokens found %d possible secrets, %s aborted:\n\n",
+		len(findings),
+		strings.TrimPrefix(hook, "pre-"),
+	)
+	writer := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, finding := range findings {
+		location := fmt.Sprintf("%s:%d", finding.FileName, finding.LineNumber)
+		if finding.CommitHash != "" {
+			location = shortHash(finding.CommitHash) + " " + location
+		}
+		fmt.Fprintf(
+			writer,
+			"  %s\t%s\t%s\n",
+			location,
+			finding.SecretType,
+			finding.Content,
+		)
+	}
+	writer.Flush()
+	fmt.Fprintf(
+		os.Stderr,
+		"\nRemove the secrets, or bypass the check with --no-verify.\n",
+	)
+
+	return exitHookSecretsFound
+}
+
+func (c hookRunCommand) Help() string {
+	return "Usage: git-tokens hook run [--baseline file] " +
+		"<pre-commit | pre-push> <repo path> [hook arguments]..."
+}
+
+func (c hookRunCommand) Synopsis() string {
+	return "Check staged changes or pushed commits, used by installed hooks"
+}
+
+type baselineCommand struct{}
+
+func (c baselineCommand) Run(rawArgs []string) int {
+	fmt.Printf(
+		"Missing subcommand\n%s\n",
+		c.Help(),
+	)
+
+	return exitMissingSubcommamd
+}
+
+func (c baselineCommand) Help() string {
+	return "Usage: git-tokens baseline [create]"
+}
+
+func (c baselineCommand) Synopsis() string {
+	return "Manage baselines of accepted secrets"
+}
+
+type baselineCreateCommand struct{}
+
+func (c baselineCreateCommand) Run(rawArgs []string) int {
+	flags := newFlagSet("baseline create", c.Help)
+	output := flags.String("output", "", "write to this file instead of stdout")
+	err := flags.Parse(rawArgs)
+	if err != nil {
+		log.Printf("Could not parse arguments: %s\n", err)
+		return exitBaselineCreateError
+	}
+
+	if !confirmRawArgsLenOrLogError(flags.Args(), 1, c.Help) {
+		return exitBaselineCreateError
+	}
+
+	scanner, err := newScanner()
+	if err != nil {
+		log.Printf("Could not create new scanner, %s\n", err)
+		return exitNewScannerError
+	}
+
+	repoUrl := flags.Arg(0)
+	baseline, err := scanner.CreateBaseline(repoUrl)
+	if err != nil {
+		log.Printf("Could not create baseline of %s: %s\n", repoUrl, err)
+		return exitBaselineCreateError
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		w, err = os.Create(*output)
+		if err != nil {
+			log.Printf("Could not create %s: %s\n", *output, err)
+			return exitBaselineCreateError
+		}
+		defer w.Close()
+	}
+
+	err = baseline.Write(w)
+	if err != nil {
+		log.Printf("Could not write baseline: %s\n", err)
+		return exitBaselineCreateError
+	}
+	log.Printf(
+		"Wrote %d baseline entries for %s\n",
+		len(baseline.Findings), repoUrl,
+	)
+
+	return exitSuccess
+}
+
+func (c baselineCreateCommand) Help() string {
+	return "Usage: git-tokens baseline create [--output <file>] <repo url>\n\n" +
+		"Lists every secret found in the repo by secret type, file and " +
+		"secret hash.\nScans with --baseline <file> suppress these secrets, " +
+		"wherever in the file they\nmove."
+}
+
+func (c baselineCreateCommand) Synopsis() string {
+	return "Write the findings of a repo to a baseline file"
+}
+
+type configCommand struct{}
+
+func (c configCommand) Run(rawArgs []string) int {
+	fmt.Printf(
+		"Missing subcommand\n%s\n",
+		c.Help(),
+	)
+
+	return exitMissingSubcommamd
+}
+
+func (c configCommand) Help() string {
+	return "Usage: git-tokens config [show]"
+}
+
+func (c configCommand) Synopsis() string {
+	return "Inspect the configuration"
+}
+
+type configShowCommand struct{}
+
+func (c configShowCommand) Run(rawArgs []string) int {
+	if !confirmRawArgsLenOrLogError(rawArgs, 0, c.Help) {
+		return exitConfigError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+	for _, setting := range settings {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\n",
+			setting,
+			currentConfig.value(setting),
+			currentConfig.sources[setting],
+		)
+	}
+	w.Flush()
+
+	if len(currentConfig.files) > 0 {
+		fmt.Printf("\nConfig files: %s\n", strings.Join(currentConfig.files, ", "))
+	}
+
+	return exitSuccess
+}
+
+func (c configShowCommand) Help() string {
+	return "Usage: git-tokens config show\n\n" + configPrecedence
+}
+
+func (c configShowCommand) Synopsis() string {
+	return "Print the settings in effect and where they come from"
+}
+
+func main() {
+	config, args, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Printf("Could not load config: %s\n", err)
+		os.Exit(exitConfigError)
+	}
+	currentConfig = config
+
+	c := cli.NewCLI("git-token", version)
+	c.Args = args
+	c.HelpFunc = func(commands map[string]cli.CommandFactory) string {
+		return cli.BasicHelpFunc("git-token")(commands) +
+			"\n\nGlobal options:\n" +
+			"    --config <file>       config file to use instead of the defaults\n" +
+			"    --db <file>           SQLite database\n" +
+			"    --workdir <dir>       directory for repository mirrors\n" +
+			"    --workers <n>         number of concurrent scan workers\n" +
+			"    --credentials <file>  credentials file\n\n" +
+			configPrecedence
+	}
+	c.Commands = map[string]cli.CommandFactory{
+		"repo": func() (cli.Command, error) {
+			return repoCommand{}, nil
+		},
+
+		"repo add": func() (cli.Command, error) {
+			return repoAddCommand{}, nil
+		},
+
+		"repo remove": func() (cli.Command, error) {
+			return repoRemoveCommand{}, nil
+		},
+
+		"repo list": func() (cli.Command, error) {
+			return repoListCommand{}, nil
+		},
+
+		"secret-type": func() (cli.Command, error) {
+			return secretTypeCommand{}, nil
+		},
+
+		"secret-type add": func() (cli.Command, error) {
+			return secretTypeAddCommand{}, nil
+		},
+
+		"secret-type remove": func() (cli.Command, error) {
+			return secretTypeRemoveCommand{}, nil
+		},
+
+		"secret-type update": func() (cli.Command, error) {
+			return secretTypeUpdateCommand{}, nil
+		},
+
+		"secret-type list": func() (cli.Command, error) {
+			return secretTypeListCommand{}, nil
+		},
+
+		"secret-type import-defaults": func() (cli.Command, error) {
+			return secretTypeImportDefaultsCommand{}, nil
+		},
+
+		"secret-type import": func() (cli.Command, error) {
+			return secretTypeImportCommand{}, nil
+		},
+
+		"secret-type export": func() (cli.Command, error) {
+			return secretTypeExportCommand{}, nil
+		},
+
+		"secret-type test": func() (cli.Command, error) {
+			return secretTypeTestCommand{}, nil
+		},
+
+		"scan": func() (cli.Command, error) {
+			return scanCommand{}, nil
+		},
+
+		"scan all": func() (cli.Command, error) {
+			return scanAllCommand{}, nil
+		},
+
+		"scan repo": func() (cli.Command, error) {
+			return scanRepoCommand{}, nil
+		},
+
+		"scan path": func() (cli.Command, error) {
+			return scanPathCommand{}, nil
+		},
+
+		"finding": func() (cli.Command, error) {
+			return findingCommand{}, nil
+		},
+
+		"finding list": func() (cli.Command, error) {
+			return findingListCommand{}, nil
+		},
+
+		"finding confirm": func() (cli.Command, error) {
+			return findingConfirmCommand{}, nil
+		},
+		"finding resolve": func() (cli.Command, error) {
+			return findingResolveCommand{}, nil
+		},
+
+		"finding ignore": func() (cli.Command, error) {
+			return findingIgnoreCommand{}, nil
+		},
+
+		"finding reopen": func() (cli.Command, error) {
+			return findingReopenCommand{}, nil
+		},
+
+		"hook": func() (cli.Command, error) {
+			return hookCommand{}, nil
+		},
+
+		"hook install": func() (cli.Command, error) {
+			return hookInstallCommand{}, nil
+		},
+
+		"hook run": func() (cli.Command, error) {
+			return hookRunCommand{}, nil
+		},
+
+		"db": func() (cli.Command, error) {
+			return dbCommand{}, nil
+		},
+
+		"db migrate": func() (cli.Command, error) {
+			return dbMigrateCommand{}, nil
+		},
+
+		"baseline": func() (cli.Command, error) {
+			return baselineCommand{}, nil
+		},
+
+		"baseline create": func() (cli.Command, error) {
+			return baselineCreateCommand{}, nil
+		},
+
+		"config": func() (cli.Command, error) {
+			return configCommand{}, nil
+		},
+
+		"config show": func() (cli.Command, error) {
+			return configShowCommand{}, nil
 		},
 	}
 
@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Reasons a match is suppressed instead of reported
+const (
+	SuppressedPath      = "path"
+	SuppressedInline    = "inline"
+	SuppressedAllowlist = "allowlist"
+	SuppressedBaseline  = "baseline"
+
+	// allowMarker on a line suppresses all matches on that line
+	allowMarker = "git-tokens:allow"
+)
+
+var SuppressionReasons = []string{
+	SuppressedPath,
+	SuppressedInline,
+	SuppressedAllowlist,
+	SuppressedBaseline,
+}
+
+// pathAllowlist holds compiled path globs. Files matching any of them are
+// not reported.
+type pathAllowlist []*regexp.Regexp
+
+// globRegexp translates a path glob into a regex. "*" and "?" do not match
+// "/", "**" matches across directories and "**/" also matches no directory.
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+// SetAllowedPaths sets the path globs, such as vendor/** or **/*_test.go,
+// of files whose matches are suppressed in all repositories.
+func (s *Scanner) SetAllowedPaths(globs []string) error {
+	allowedPaths := pathAllowlist{}
+	for _, glob := range globs {
+		re, err := globRegexp(strings.TrimPrefix(glob, "/"))
+		if err != nil {
+			return fmt.Errorf("invalid allowlist path \"%s\": %w", glob, err)
+		}
+		allowedPaths = append(allowedPaths, re)
+	}
+
+	s.allowedPaths = allowedPaths
+
+	return nil
+}
+
+// commitRuleVersion returns the version of secretType recorded for commits
+// scanned with it. Matches in allowed paths are not stored, so commits are
+// scanned again once the path allowlist changes.
+func (a pathAllowlist) commitRuleVersion(secretType compiledSecretType) string {
+	if len(a) == 0 {
+		return secretType.version
+	}
+
+	exprs := []string{}
+	for _, re := range a {
+		exprs = append(exprs, re.String())
+	}
+	sort.Strings(exprs)
+
+	sum := sha256.Sum256(
+		[]byte(secretType.version + "\n" + strings.Join(exprs, "\n")),
+	)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (a pathAllowlist) allows(fileName string) bool {
+	for _, re := range a {
+		if re.MatchString(fileName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchLine reports whether line of fileName holds a secret of secretType
+// and, if so, the reason it is suppressed, or "" if it is to be reported.
+// objects may be nil where the repository is not known.
+func matchLine(
+	secretType compiledSecretType,
+	allowedPaths pathAllowlist,
+	objects objectIDs,
+	fileName string,
+	line string,
+) (bool, string) {
+	matched, allowlisted := false, false
+	for _, match := range secretType.findSecrets(line) {
+		switch {
+		case match.Suppressed == "" && secretType.skipObjectIDs &&
+			objects != nil && objects(match.Secret):
+		case match.Suppressed == "":
+			matched = true
+		case match.Suppressed == "allowlisted":
+			allowlisted = true
+		}
+	}
+
+	switch {
+	case !matched && !allowlisted:
+		return false, ""
+	case allowedPaths.allows(fileName):
+		return true, SuppressedPath
+	case strings.Contains(line, allowMarker):
+		return true, SuppressedInline
+	case !matched:
+		return true, SuppressedAllowlist
+	}
+
+	return true, ""
+}
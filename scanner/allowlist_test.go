@@ -0,0 +1,86 @@
+package scanner
+
+import "testing"
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob     string
+		fileName string
+		want     bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "scanner/main.go", false},
+		{"*.go", "main.go.orig", false},
+		{"vendor/**", "vendor/a.go", true},
+		{"vendor/**", "vendor/github.com/x/a.go", true},
+		{"vendor/**", "src/vendor/a.go", false},
+		{"**/*_test.go", "a_test.go", true},
+		{"**/*_test.go", "scanner/deep/a_test.go", true},
+		{"**/*_test.go", "scanner/a.go", false},
+		{"docs/**/*.md", "docs/a.md", true},
+		{"docs/**/*.md", "docs/x/y/a.md", true},
+		{"docs/**/*.md", "a.md", false},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"?.txt", "/.txt", false},
+		{"a.b", "a.b", true},
+		{"a.b", "axb", false},
+		{"[x].txt", "[x].txt", true},
+		{"[x].txt", "x.txt", false},
+	}
+
+	for _, test := range tests {
+		re, err := globRegexp(test.glob)
+		if err != nil {
+			t.Fatalf("globRegexp(%q): %s", test.glob, err)
+		}
+
+		if got := re.MatchString(test.fileName); got != test.want {
+			t.Errorf(
+				"globRegexp(%q) matches %q = %t, want %t",
+				test.glob, test.fileName, got, test.want,
+			)
+		}
+	}
+}
+
+func TestCommitRuleVersion(t *testing.T) {
+	secretType := compiledSecretType{version: "v1"}
+
+	allowlist := func(globs ...string) pathAllowlist {
+		s := &Scanner{}
+		err := s.SetAllowedPaths(globs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.allowedPaths
+	}
+
+	if got := allowlist().commitRuleVersion(secretType); got != "v1" {
+		t.Errorf("version without allowlist = %q, want the rule version", got)
+	}
+
+	vendor := allowlist("vendor/**").commitRuleVersion(secretType)
+	tests := []struct {
+		name      string
+		allowlist pathAllowlist
+		same      bool
+	}{
+		{"no allowlist", allowlist(), false},
+		{"same glob", allowlist("/vendor/**"), true},
+		{"other glob", allowlist("docs/**"), false},
+		{"added glob", allowlist("vendor/**", "docs/**"), false},
+	}
+
+	for _, test := range tests {
+		got := test.allowlist.commitRuleVersion(secretType)
+		if (got == vendor) != test.same {
+			t.Errorf("%s: version %q, vendor/** version %q", test.name, got, vendor)
+		}
+	}
+
+	reordered := allowlist("docs/**", "vendor/**").commitRuleVersion(secretType)
+	if reordered != allowlist("vendor/**", "docs/**").commitRuleVersion(secretType) {
+		t.Errorf("version depends on the order of globs")
+	}
+}
@@ -0,0 +1,139 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const baselineVersion = 1
+
+// BaselineEntry identifies an accepted secret by its rule, file and secret
+// hash, so it still matches after the line it is on moves.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	SecretType  string `json:"secret_type"`
+	FileName    string `json:"file"`
+	SecretHash  string `json:"secret_hash"`
+}
+
+// BaselineFile is the content of a baseline file.
+type BaselineFile struct {
+	Version  int             `json:"version"`
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// Baseline holds the fingerprints of accepted secrets. Scans suppress
+// matches in it.
+type Baseline map[string]bool
+
+func baselineFingerprint(secretType string, fileName string, secretHash string) string {
+	return hashSecret(secretType + "\x00" + fileName + "\x00" + secretHash)
+}
+
+func (b Baseline) contains(finding Finding) bool {
+	return b[baselineFingerprint(
+		finding.SecretType,
+		finding.FileName,
+		finding.SecretHash,
+	)]
+}
+
+// filter returns the findings not in the baseline and the number left out.
+func (b Baseline) filter(findings []Finding) ([]Finding, int) {
+	kept := []Finding{}
+	for _, finding := range findings {
+		if !b.contains(finding) {
+			kept = append(kept, finding)
+		}
+	}
+
+	return kept, len(findings) - len(kept)
+}
+
+// CreateBaseline returns a baseline with an entry for every distinct secret
+// found in the repository, whatever its status.
+func (s *Scanner) CreateBaseline(repoUrl string) (BaselineFile, error) {
+	_, err := s.GetRepo(repoUrl)
+	if err != nil {
+		return BaselineFile{}, err
+	}
+
+	findings, err := s.QueryFindings(FindingQuery{Repository: repoUrl})
+	if err != nil {
+		return BaselineFile{}, err
+	}
+
+	entries := []BaselineEntry{}
+	seen := map[string]bool{}
+	for _, finding := range findings {
+		fingerprint := baselineFingerprint(
+			finding.SecretType,
+			finding.FileName,
+			finding.SecretHash,
+		)
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+
+		entries = append(entries, BaselineEntry{
+			Fingerprint: fingerprint,
+			SecretType:  finding.SecretType,
+			FileName:    finding.FileName,
+			SecretHash:  finding.SecretHash,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FileName != entries[j].FileName {
+			return entries[i].FileName < entries[j].FileName
+		}
+		if entries[i].SecretType != entries[j].SecretType {
+			return entries[i].SecretType < entries[j].SecretType
+		}
+		return entries[i].SecretHash < entries[j].SecretHash
+	})
+
+	return BaselineFile{baselineVersion, entries}, nil
+}
+
+func (f BaselineFile) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(f)
+}
+
+// LoadBaseline reads a baseline file written by BaselineFile.Write. Entries are
+// keyed on their rule, file and secret hash, the fingerprint in the file is
+// only informational.
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := BaselineFile{}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Version != baselineVersion {
+		return nil, fmt.Errorf("unknown baseline version %d", file.Version)
+	}
+
+	baseline := Baseline{}
+	for _, entry := range file.Findings {
+		baseline[baselineFingerprint(
+			entry.SecretType,
+			entry.FileName,
+			entry.SecretHash,
+		)] = true
+	}
+
+	return baseline, nil
+}
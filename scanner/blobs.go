@@ -0,0 +1,249 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// blobMatch is a line of a blob that holds a secret of a secret type. Path
+// allowlists are applied when the match is attributed to a file.
+type blobMatch struct {
+	SecretType string `json:"secret_type"`
+	LineNumber int    `json:"line"`
+}
+
+type scannedBlob struct {
+	hash        string
+	ruleVersion string
+	matches     []blobMatch
+}
+
+// blobCache holds the blobs scanned with one set of secret types. Blobs are
+// identified by content, so the cache is shared by all commits and
+// repositories.
+type blobCache struct {
+	mu      sync.Mutex
+	matches map[plumbing.Hash][]blobMatch
+	version string
+}
+
+func (c *blobCache) get(hash plumbing.Hash) ([]blobMatch, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	matches, ok := c.matches[hash]
+
+	return matches, ok
+}
+
+func (c *blobCache) put(hash plumbing.Hash, matches []blobMatch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.matches[hash] = matches
+}
+
+// ruleSetVersion combines the versions of secretTypes, so cached blobs are
+// rescanned once any of them changes.
+func ruleSetVersion(secretTypes []compiledSecretType) string {
+	versions := make([]string, len(secretTypes))
+	for i, secretType := range secretTypes {
+		versions[i] = secretType.version
+	}
+	sort.Strings(versions)
+
+	sum := sha256.Sum256([]byte(strings.Join(versions, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// blobCache returns the cache of blobs scanned with secretTypes, loading it
+// from the database the first time it is needed.
+func (s *Scanner) blobCache(secretTypes []compiledSecretType) (*blobCache, error) {
+	version := ruleSetVersion(secretTypes)
+
+	s.blobCachesMu.Lock()
+	defer s.blobCachesMu.Unlock()
+
+	if cache, ok := s.blobCaches[version]; ok {
+		return cache, nil
+	}
+
+	rows, err := s.db.Query(
+		`SELECT blob_hash, matches FROM scanned_blobs WHERE rule_version = ?`,
+		version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cache := &blobCache{
+		matches: map[plumbing.Hash][]blobMatch{},
+		version: version,
+	}
+	for rows.Next() {
+		var hash, matchesJSON string
+		err := rows.Scan(&hash, &matchesJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		matches := []blobMatch{}
+		err = json.Unmarshal([]byte(matchesJSON), &matches)
+		if err != nil {
+			return nil, err
+		}
+		cache.matches[plumbing.NewHash(hash)] = matches
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.blobCaches[version] = cache
+
+	return cache, nil
+}
+
+func addScannedBlob(q execQueryer, blob scannedBlob) error {
+	matches, err := json.Marshal(blob.matches)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(
+		`
+			INSERT OR IGNORE INTO scanned_blobs (
+				blob_hash,
+				rule_version,
+				matches
+			)
+			VALUES (?, ?, ?)
+		`,
+		blob.hash, blob.ruleVersion, string(matches),
+	)
+
+	return err
+}
+
+// matchBlob returns the lines of a blob that hold a secret of any of
+// secretTypes, including ones suppressed by allowlists or inline markers.
+func matchBlob(lines []string, secretTypes []compiledSecretType) []blobMatch {
+	matches := []blobMatch{}
+	for _, secretType := range secretTypes {
+		for i, line := range lines {
+			matched, _ := matchLine(secretType, nil, nil, "", line)
+			if matched {
+				matches = append(matches, blobMatch{secretType.Name, i + 1})
+			}
+		}
+	}
+
+	return matches
+}
+
+// blobFindings scans the files of commit, matching each blob not in cache
+// once, and masks the content of findings with maskSecretTypes. It returns
+// the findings, the suppressed matches by reason and the newly scanned blobs
+// to store.
+func (s *Scanner) blobFindings(
+	repoUrl string,
+	commit *object.Commit,
+	secretTypes []compiledSecretType,
+	maskSecretTypes []compiledSecretType,
+	objects objectIDs,
+	cache *blobCache,
+	options ScanOptions,
+) ([]Finding, map[string]int, []scannedBlob, error) {
+	byName := map[string]compiledSecretType{}
+	for _, secretType := range secretTypes {
+		byName[secretType.Name] = secretType
+	}
+
+	files, err := commit.Files()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	findings := []Finding{}
+	suppressed := map[string]int{}
+	scanned := []scannedBlob{}
+	err = files.ForEach(func(file *object.File) error {
+		var lines []string
+		matches, ok := cache.get(file.Hash)
+		if !ok {
+			content, err := file.Contents()
+			if err != nil {
+				return err
+			}
+
+			lines = strings.Split(content, "\n")
+			matches = matchBlob(lines, secretTypes)
+			cache.put(file.Hash, matches)
+			scanned = append(scanned, scannedBlob{
+				file.Hash.String(),
+				cache.version,
+				matches,
+			})
+		}
+
+		if len(matches) == 0 {
+			return nil
+		}
+
+		if lines == nil {
+			content, err := file.Contents()
+			if err != nil {
+				return err
+			}
+			lines = strings.Split(content, "\n")
+		}
+
+		for _, match := range matches {
+			secretType, ok := byName[match.SecretType]
+			if !ok || match.LineNumber > len(lines) {
+				continue
+			}
+			line := lines[match.LineNumber-1]
+
+			matched, reason := matchLine(
+				secretType,
+				s.allowedPaths,
+				objects,
+				file.Name,
+				line,
+			)
+			if !matched {
+				continue
+			}
+			if reason != "" {
+				suppressed[reason]++
+				continue
+			}
+
+			finding := secretType.redactFinding(withCommit(Finding{
+				FileName:   file.Name,
+				LineNumber: match.LineNumber,
+				Content:    line,
+				TreeName:   commit.Hash.String(),
+				Repository: repoUrl,
+				SecretType: secretType.Name,
+			}, commit), maskSecretTypes, options.ShowSecrets)
+			findings = append(findings, finding)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return findings, suppressed, scanned, nil
+}
@@ -0,0 +1,271 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	CredentialBasic    = "basic"
+	CredentialToken    = "token"
+	CredentialSSHKey   = "ssh-key"
+	CredentialSSHAgent = "ssh-agent"
+	CredentialHelper   = "helper"
+
+	defaultTokenUsername = "x-access-token"
+	defaultSSHUsername   = "git"
+
+	// Fallback token for HTTP(S) repositories without a matching credential
+	tokenEnv         = "GIT_TOKENS_TOKEN"
+	tokenUsernameEnv = "GIT_TOKENS_USERNAME"
+)
+
+// Credential configures how repositories matching Match authenticate. Match
+// is either a URL prefix such as https://github.com/acme/ or a host glob
+// such as *.example.com. Secrets are best taken from the environment.
+type Credential struct {
+	Match            string `yaml:"match"`
+	Type             string `yaml:"type"`
+	Username         string `yaml:"username"`
+	UsernameEnv      string `yaml:"username_env"`
+	Password         string `yaml:"password"`
+	PasswordEnv      string `yaml:"password_env"`
+	Token            string `yaml:"token"`
+	TokenEnv         string `yaml:"token_env"`
+	KeyFile          string `yaml:"key_file"`
+	KeyPassphraseEnv string `yaml:"key_passphrase_env"`
+}
+
+type credentialsFile struct {
+	Credentials []Credential `yaml:"credentials"`
+}
+
+// LoadCredentials reads the credentials file at path. Credentials only live
+// in memory and are never written to the database.
+func (s *Scanner) LoadCredentials(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	file := credentialsFile{}
+	err = yaml.Unmarshal(data, &file)
+	if err != nil {
+		return err
+	}
+
+	for _, credential := range file.Credentials {
+		switch credential.Type {
+		case CredentialBasic, CredentialToken, CredentialSSHKey,
+			CredentialSSHAgent, CredentialHelper:
+		default:
+			return fmt.Errorf(
+				"unknown credential type \"%s\" for \"%s\"",
+				credential.Type, credential.Match,
+			)
+		}
+
+		if credential.Match == "" {
+			return fmt.Errorf("credential of type \"%s\" needs a match", credential.Type)
+		}
+
+		if (credential.Password != "" || credential.Token != "") &&
+			info.Mode().Perm()&0o077 != 0 {
+			log.Printf(
+				"Credentials file %s holds secrets but is readable by others\n",
+				path,
+			)
+		}
+	}
+
+	s.credentials = file.Credentials
+
+	return nil
+}
+
+// matches reports how specific the match of credential against the
+// repository is, or 0 if it does not match.
+func (c Credential) matches(repoUrl string, endpoint *transport.Endpoint) int {
+	if strings.Contains(c.Match, "://") {
+		if strings.HasPrefix(repoUrl, c.Match) {
+			return len(c.Match)
+		}
+		return 0
+	}
+
+	if matched, _ := path.Match(strings.ToLower(c.Match), strings.ToLower(endpoint.Host)); matched {
+		return len(c.Match)
+	}
+
+	return 0
+}
+
+func (c Credential) value(value string, env string) string {
+	if env != "" {
+		return os.Getenv(env)
+	}
+
+	return value
+}
+
+func (c Credential) username(endpoint *transport.Endpoint, fallback string) string {
+	if username := c.value(c.Username, c.UsernameEnv); username != "" {
+		return username
+	}
+	if endpoint.User != "" {
+		return endpoint.User
+	}
+
+	return fallback
+}
+
+// credentialHelperAuth asks the git credential helpers configured for the
+// current user, as "git credential fill" does.
+func credentialHelperAuth(
+	endpoint *transport.Endpoint,
+	username string,
+) (transport.AuthMethod, error) {
+	input := fmt.Sprintf(
+		"protocol=%s\nhost=%s\npath=%s\n",
+		endpoint.Protocol,
+		endpoint.Host,
+		strings.TrimPrefix(endpoint.Path, "/"),
+	)
+	if username != "" {
+		input += "username=" + username + "\n"
+	}
+
+	command := exec.Command("git", "credential", "fill")
+	command.Stdin = strings.NewReader(input + "\n")
+	command.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git credential fill: %w", err)
+	}
+
+	auth := &http.BasicAuth{}
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		key, value, _ := strings.Cut(string(line), "=")
+		switch key {
+		case "username":
+			auth.Username = value
+		case "password":
+			auth.Password = value
+		}
+	}
+
+	return auth, nil
+}
+
+func (c Credential) authMethod(endpoint *transport.Endpoint) (transport.AuthMethod, error) {
+	switch c.Type {
+	case CredentialBasic:
+		return &http.BasicAuth{
+			Username: c.username(endpoint, ""),
+			Password: c.value(c.Password, c.PasswordEnv),
+		}, nil
+	case CredentialToken:
+		token := c.value(c.Token, c.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("no token for \"%s\"", c.Match)
+		}
+		return &http.BasicAuth{
+			Username: c.username(endpoint, defaultTokenUsername),
+			Password: token,
+		}, nil
+	case CredentialSSHKey:
+		keyFile := c.KeyFile
+		if strings.HasPrefix(keyFile, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			keyFile = home + keyFile[1:]
+		}
+		return ssh.NewPublicKeysFromFile(
+			c.username(endpoint, defaultSSHUsername),
+			keyFile,
+			c.value("", c.KeyPassphraseEnv),
+		)
+	case CredentialSSHAgent:
+		return ssh.NewSSHAgentAuth(c.username(endpoint, defaultSSHUsername))
+	case CredentialHelper:
+		return credentialHelperAuth(endpoint, c.value(c.Username, c.UsernameEnv))
+	default:
+		return nil, fmt.Errorf("unknown credential type \"%s\"", c.Type)
+	}
+}
+
+// authFor returns the authentication for repoUrl from the most specific
+// matching credential. HTTP(S) repositories without one fall back to a
+// token from the environment. A nil result leaves the choice to go-git,
+// which uses the ssh-agent for SSH repositories.
+func (s *Scanner) authFor(repoUrl string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repoUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *Credential
+	bestScore := 0
+	for i, credential := range s.credentials {
+		if score := credential.matches(repoUrl, endpoint); score > bestScore {
+			best, bestScore = &s.credentials[i], score
+		}
+	}
+	if best != nil {
+		return best.authMethod(endpoint)
+	}
+
+	token := os.Getenv(tokenEnv)
+	if token != "" && (endpoint.Protocol == "http" || endpoint.Protocol == "https") {
+		username := os.Getenv(tokenUsernameEnv)
+		if username == "" {
+			username = defaultTokenUsername
+		}
+		return &http.BasicAuth{Username: username, Password: token}, nil
+	}
+
+	return nil, nil
+}
+
+// checkNoCredentials rejects URLs with a password, or with any user info on
+// HTTP(S) where a token often stands in for the user name, which would
+// otherwise end up in the database. Such credentials belong in the
+// credentials file.
+func checkNoCredentials(URL string) error {
+	parsed, err := url.Parse(URL)
+	if err != nil || parsed.User == nil {
+		return nil
+	}
+
+	if _, ok := parsed.User.Password(); ok {
+		return fmt.Errorf(
+			"repo URL contains a password, use a credentials file instead",
+		)
+	}
+
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		return fmt.Errorf(
+			"repo URL contains user info, use a credentials file instead",
+		)
+	}
+
+	return nil
+}
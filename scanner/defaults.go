@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	_ "embed"
+	"encoding/json"
+)
+
+// The built-in rules are versioned individually. Bump the version of a rule
+// whenever its regex changes so that import-defaults updates databases that
+// imported an older revision.
+//
+//go:embed default_secret_types.json
+var defaultSecretTypesJSON []byte
+
+// genericSecretTypes are the built-in rules that match secrets of any kind.
+// They do not report secrets that a more specific rule on the same line finds.
+var genericSecretTypes = map[string]bool{
+	"generic-secret-assignment": true,
+}
+
+type defaultSecretType struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Version     int     `json:"version"`
+	Regex       string  `json:"regex"`
+	Entropy     float64 `json:"entropy"`
+}
+
+func DefaultSecretTypes() ([]SecretType, error) {
+	defaults := []defaultSecretType{}
+	err := json.Unmarshal(defaultSecretTypesJSON, &defaults)
+	if err != nil {
+		return []SecretType{}, err
+	}
+
+	secretTypes := []SecretType{}
+	for _, secretType := range defaults {
+		secretTypes = append(secretTypes, SecretType{
+			Name:        secretType.Name,
+			Regex:       secretType.Regex,
+			Description: secretType.Description,
+			Version:     secretType.Version,
+			Entropy:     secretType.Entropy,
+		})
+	}
+
+	return secretTypes, nil
+}
+
+// ImportDefaultSecretTypes adds the built-in rules to the database and
+// updates those whose stored version is older than the built-in one. It
+// returns the number of rules added or updated.
+func (s *Scanner) ImportDefaultSecretTypes() (int, error) {
+	secretTypes, err := DefaultSecretTypes()
+	if err != nil {
+		return 0, err
+	}
+
+	return s.ImportSecretTypes(secretTypes, false)
+}
@@ -0,0 +1,204 @@
+package scanner
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type addedLine struct {
+	fileName   string
+	lineNumber int
+	content    string
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+func addedLinesBetween(from *object.Tree, to *object.Tree) ([]addedLine, error) {
+	patch, err := from.Patch(to)
+	if err != nil {
+		return []addedLine{}, err
+	}
+
+	lines := []addedLine{}
+	for _, filePatch := range patch.FilePatches() {
+		if filePatch.IsBinary() {
+			continue
+		}
+
+		_, toFile := filePatch.Files()
+		if toFile == nil {
+			continue
+		}
+
+		lineNumber := 1
+		for _, chunk := range filePatch.Chunks() {
+			chunkLines := splitLines(chunk.Content())
+
+			switch chunk.Type() {
+			case diff.Equal:
+				lineNumber += len(chunkLines)
+			case diff.Add:
+				for _, line := range chunkLines {
+					lines = append(lines, addedLine{
+						toFile.Path(),
+						lineNumber,
+						line,
+					})
+					lineNumber++
+				}
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+// addedLines returns the lines commit adds relative to its parents. A root
+// commit adds all of its lines. For merge commits only lines that are new
+// relative to every parent are returned, so content merged in from either
+// side is attributed to the commit that originally introduced it.
+func addedLines(commit *object.Commit) ([]addedLine, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return []addedLine{}, err
+	}
+
+	if commit.NumParents() == 0 {
+		return addedLinesBetween(nil, tree)
+	}
+
+	var lines []addedLine
+	for i := 0; i < commit.NumParents(); i++ {
+		parent, err := commit.Parent(i)
+		if err != nil {
+			return []addedLine{}, err
+		}
+
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return []addedLine{}, err
+		}
+
+		parentLines, err := addedLinesBetween(parentTree, tree)
+		if err != nil {
+			return []addedLine{}, err
+		}
+
+		if i == 0 {
+			lines = parentLines
+			continue
+		}
+
+		addedToParent := map[addedLine]bool{}
+		for _, line := range parentLines {
+			addedToParent[line] = true
+		}
+
+		commonLines := []addedLine{}
+		for _, line := range lines {
+			if addedToParent[line] {
+				commonLines = append(commonLines, line)
+			}
+		}
+		lines = commonLines
+	}
+
+	return lines, nil
+}
+
+// matchAddedLines runs secretTypes against lines. The returned findings are
+// copies of finding with the location, content and secret type filled in and
+// the content masked with maskSecretTypes, suppressed matches are only
+// counted by reason.
+func matchAddedLines(
+	lines []addedLine,
+	secretTypes []compiledSecretType,
+	maskSecretTypes []compiledSecretType,
+	allowedPaths pathAllowlist,
+	objects objectIDs,
+	finding Finding,
+	showSecrets bool,
+) ([]Finding, map[string]int) {
+	findings := []Finding{}
+	suppressed := map[string]int{}
+	for _, secretType := range secretTypes {
+		for _, line := range lines {
+			matched, reason := matchLine(
+				secretType,
+				allowedPaths,
+				objects,
+				line.fileName,
+				line.content,
+			)
+			if !matched {
+				continue
+			}
+			if reason != "" {
+				suppressed[reason]++
+				continue
+			}
+
+			finding.FileName = line.fileName
+			finding.LineNumber = line.lineNumber
+			finding.Content = line.content
+			finding.SecretType = secretType.Name
+			findings = append(
+				findings,
+				secretType.redactFinding(finding, maskSecretTypes, showSecrets),
+			)
+		}
+	}
+
+	return findings, suppressed
+}
+
+func (s *Scanner) scanCommitDiff(
+	repoUrl string,
+	commit *object.Commit,
+	secretTypes []compiledSecretType,
+	maskSecretTypes []compiledSecretType,
+	objects objectIDs,
+	options ScanOptions,
+) (scanResult, error) {
+	defer log.Printf("Done scanning repo %s, commit %s\n", repoUrl, commit.Hash)
+
+	log.Printf("Scanning diff of repo %s, commit %s\n", repoUrl, commit.Hash)
+
+	lines, err := addedLines(commit)
+	if err != nil {
+		return scanResult{}, fmt.Errorf("could not diff: %w", err)
+	}
+
+	findings, suppressed := matchAddedLines(
+		lines,
+		secretTypes,
+		maskSecretTypes,
+		s.allowedPaths,
+		objects,
+		withCommit(Finding{
+			TreeName:   commit.Hash.String(),
+			Repository: repoUrl,
+		}, commit),
+		options.ShowSecrets,
+	)
+
+	return scanResult{
+		repoUrl,
+		commit.Hash.String(),
+		findings,
+		suppressed,
+		nil,
+		scannedRules(secretTypes, s.allowedPaths),
+		nil,
+	}, nil
+}
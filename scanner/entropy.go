@@ -0,0 +1,48 @@
+package scanner
+
+import (
+	"math"
+)
+
+// shannonEntropy returns the Shannon entropy of data in bits per character.
+// Random base64 strings score close to 6 and random hex strings close to 4,
+// while words and placeholder values score far lower.
+func shannonEntropy(data string) float64 {
+	counts := map[rune]int{}
+	length := 0
+	for _, r := range data {
+		counts[r]++
+		length++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(length)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
+
+// HighEntropySecretTypes are generic detectors for random-looking strings
+// without a known prefix. They are not stored in the database and only run
+// when a scan asks for them. Strings that are ids of objects in the scanned
+// repository, such as commit hashes, are not reported.
+func HighEntropySecretTypes() []SecretType {
+	return []SecretType{
+		{
+			Name:        "high-entropy-base64-string",
+			Regex:       `[0-9A-Za-z+/_\-]{20,}={0,2}`,
+			Description: "Base64 string with high Shannon entropy",
+			Version:     1,
+			Entropy:     4.5,
+		},
+		{
+			Name:        "high-entropy-hex-string",
+			Regex:       `\b[0-9A-Fa-f]{32,}\b`,
+			Description: "Hex string of at least 32 characters with high Shannon entropy",
+			Version:     3,
+			Entropy:     3.0,
+		},
+	}
+}
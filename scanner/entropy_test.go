@@ -0,0 +1,69 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestHighEntropyHexObjectIDs(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := storeCommit(t, repo.Storer, map[string]string{"a.txt": "a\n"})
+
+	var hex compiledSecretType
+	for _, secretType := range HighEntropySecretTypes() {
+		if secretType.Name == "high-entropy-hex-string" {
+			hex = mustCompileSecretType(t, secretType)
+			hex.skipObjectIDs = true
+		}
+	}
+
+	tests := []struct {
+		name    string
+		line    string
+		objects objectIDs
+		want    bool
+	}{
+		{
+			"commit hash in the repository",
+			"fixed in " + commit.Hash.String(),
+			repoObjectIDs(repo),
+			false,
+		},
+		{
+			"40 character token",
+			"token = 8f3c2a9be1d4706f5a2c9e8b1d3f7a6c4e2b9d10",
+			repoObjectIDs(repo),
+			true,
+		},
+		{
+			"commit hash without a repository",
+			"fixed in " + commit.Hash.String(),
+			nil,
+			true,
+		},
+		{
+			"64 character key",
+			"key = 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+			repoObjectIDs(repo),
+			true,
+		},
+		{
+			"too short",
+			"id = 8f3c2a9be1d4706f5a2c9e8b1d3f",
+			repoObjectIDs(repo),
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		matched, _ := matchLine(hex, nil, test.objects, "a.txt", test.line)
+		if matched != test.want {
+			t.Errorf("%s: matched = %t, want %t", test.name, matched, test.want)
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package scanner
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type FindingStatus string
+
+const (
+	StatusOpen          FindingStatus = "open"
+	StatusConfirmed     FindingStatus = "confirmed"
+	StatusFalsePositive FindingStatus = "false-positive"
+	StatusRevoked       FindingStatus = "revoked"
+	StatusAcceptedRisk  FindingStatus = "accepted-risk"
+)
+
+var findingStatuses = []FindingStatus{
+	StatusOpen,
+	StatusConfirmed,
+	StatusFalsePositive,
+	StatusRevoked,
+	StatusAcceptedRisk,
+}
+
+func ParseFindingStatus(status string) (FindingStatus, error) {
+	for _, findingStatus := range findingStatuses {
+		if status == string(findingStatus) {
+			return findingStatus, nil
+		}
+	}
+
+	return StatusOpen, fmt.Errorf("unknown finding status \"%s\"", status)
+}
+
+// IsResolved reports whether a finding with this status needs no further
+// attention. Resolved findings are hidden by default.
+func (f FindingStatus) IsResolved() bool {
+	return f != StatusOpen && f != StatusConfirmed
+}
+
+type findingTriage struct {
+	Status   FindingStatus
+	Assignee string
+	Note     string
+}
+
+// withCommit fills in the commit a finding was found in.
+func withCommit(finding Finding, commit *object.Commit) Finding {
+	finding.CommitHash = commit.Hash.String()
+	finding.CommitTimestamp = commit.Committer.When
+	finding.AuthorName = commit.Author.Name
+	finding.AuthorEmail = commit.Author.Email
+	finding.CommitSubject, _, _ = strings.Cut(
+		strings.TrimSpace(commit.Message),
+		"\n",
+	)
+
+	return finding
+}
+
+// fingerprint identifies a secret independent of where it was found.
+func fingerprint(SecretTypeName string, SecretHash string) string {
+	return hashSecret(SecretTypeName + "\x00" + SecretHash)
+}
+
+// previousTriage returns the latest resolved triage of the same secret, so
+// that findings which were already dealt with stay resolved when later
+// commits, branches or repositories still contain the secret.
+func previousTriage(q queryer, Fingerprint string) (findingTriage, error) {
+	rows, err := q.Query(
+		`
+			SELECT status, assignee, note
+			FROM findings
+			WHERE fingerprint = ?
+				AND status NOT IN (?, ?)
+			ORDER BY id DESC
+			LIMIT 1
+		`,
+		Fingerprint,
+		StatusOpen,
+		StatusConfirmed,
+	)
+	if err != nil {
+		return findingTriage{}, err
+	}
+	defer rows.Close()
+
+	triage := findingTriage{Status: StatusOpen}
+	if rows.Next() {
+		err := rows.Scan(&triage.Status, &triage.Assignee, &triage.Note)
+		if err != nil {
+			return findingTriage{}, err
+		}
+	}
+
+	return triage, rows.Err()
+}
+
+// SetFindingStatus changes the status of a finding, or with group of every
+// finding of the same secret. Empty assignee and note values keep the
+// current ones.
+func (s *Scanner) SetFindingStatus(
+	ID int64,
+	group bool,
+	Status FindingStatus,
+	Assignee string,
+	Note string,
+) error {
+	result, err := s.db.Exec(
+		`
+			UPDATE findings
+			SET
+				status = ?,
+				assignee = COALESCE(NULLIF(?, ''), assignee),
+				note = COALESCE(NULLIF(?, ''), note)
+			WHERE id = ? OR (
+				? AND fingerprint = (SELECT fingerprint FROM findings WHERE id = ?)
+			)
+		`,
+		Status,
+		Assignee,
+		Note,
+		ID,
+		group,
+		ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireAffectedRow(result, "finding", fmt.Sprint(ID))
+}
+
+// findingSortColumns maps the sort keys accepted by QueryFindings to columns.
+var findingSortColumns = map[string]string{
+	"id":           "id",
+	"last-scanned": "last_scanned_ts",
+	"repository":   "repository",
+	"commit":       "commit_hash",
+	"file":         "file_name",
+	"line":         "line_number",
+	"commit-date":  "commit_ts",
+	"author":       "author_email",
+	"secret-type":  "secret_type",
+	"status":       "status",
+	"assignee":     "assignee",
+}
+
+func FindingSortKeys() []string {
+	keys := []string{}
+	for key := range findingSortColumns {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// FindingQuery selects findings. Zero values do not filter, FileGlob uses
+// SQLite GLOB syntax, Since and Until bound the last scan time and
+// CommittedSince and CommittedUntil bound the commit date.
+type FindingQuery struct {
+	Repository     string
+	SecretType     string
+	FileGlob       string
+	Statuses       []FindingStatus
+	Since          time.Time
+	Until          time.Time
+	CommittedSince time.Time
+	CommittedUntil time.Time
+	SortBy         string
+	Descending     bool
+	Limit          int
+	Offset         int
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (q FindingQuery) sql() (string, []any, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if q.Repository != "" {
+		conditions = append(conditions, "repository = ?")
+		args = append(args, normalizeRepoURL(q.Repository))
+	}
+	if q.SecretType != "" {
+		conditions = append(conditions, "secret_type = ?")
+		args = append(args, q.SecretType)
+	}
+	if q.FileGlob != "" {
+		conditions = append(conditions, "file_name GLOB ?")
+		args = append(args, q.FileGlob)
+	}
+	if len(q.Statuses) > 0 {
+		placeholders := strings.TrimSuffix(
+			strings.Repeat("?, ", len(q.Statuses)),
+			", ",
+		)
+		conditions = append(conditions, "status IN ("+placeholders+")")
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "last_scanned_ts >= ?")
+		args = append(args, formatTimestamp(q.Since))
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "last_scanned_ts < ?")
+		args = append(args, formatTimestamp(q.Until))
+	}
+	// commit_ts is stored with a UTC offset, datetime() drops it
+	if !q.CommittedSince.IsZero() {
+		conditions = append(conditions, "datetime(commit_ts) >= ?")
+		args = append(args, formatTimestamp(q.CommittedSince))
+	}
+	if !q.CommittedUntil.IsZero() {
+		conditions = append(conditions, "datetime(commit_ts) < ?")
+		args = append(args, formatTimestamp(q.CommittedUntil))
+	}
+
+	query := ""
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	sortBy := q.SortBy
+	if sortBy == "" {
+		sortBy = "id"
+	}
+	column, ok := findingSortColumns[sortBy]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown sort key \"%s\"", sortBy)
+	}
+	query += " ORDER BY " + column
+	if q.Descending {
+		query += " DESC"
+	}
+	if column != "id" {
+		query += ", id"
+	}
+
+	if q.Limit > 0 || q.Offset > 0 {
+		limit := q.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, q.Offset)
+	}
+
+	return query, args, nil
+}
+
+func (s *Scanner) QueryFindings(query FindingQuery) ([]Finding, error) {
+	clauses, args, err := query.sql()
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	rows, err := s.db.Query(
+		`
+			SELECT
+				id,
+				last_scanned_ts,
+				file_name,
+				line_number,
+				content,
+				raw_content,
+				secret_hash,
+				fingerprint,
+				commit_ts,
+				author_name,
+				author_email,
+				commit_subject,
+				tree_name,
+				commit_hash,
+				repository,
+				secret_type,
+				status,
+				assignee,
+				note
+			FROM findings
+		`+clauses,
+		args...,
+	)
+	if err != nil {
+		return []Finding{}, err
+	}
+	defer rows.Close()
+
+	findings := []Finding{}
+	for rows.Next() {
+		finding := Finding{}
+		commitTimestamp := sql.NullTime{}
+		err := rows.Scan(
+			&finding.ID,
+			&finding.LastScannedTimestamp,
+			&finding.FileName,
+			&finding.LineNumber,
+			&finding.Content,
+			&finding.RawContent,
+			&finding.SecretHash,
+			&finding.Fingerprint,
+			&commitTimestamp,
+			&finding.AuthorName,
+			&finding.AuthorEmail,
+			&finding.CommitSubject,
+			&finding.TreeName,
+			&finding.CommitHash,
+			&finding.Repository,
+			&finding.SecretType,
+			&finding.Status,
+			&finding.Assignee,
+			&finding.Note,
+		)
+		if err != nil {
+			return []Finding{}, err
+		}
+		finding.CommitTimestamp = commitTimestamp.Time
+		findings = append(findings, finding)
+	}
+
+	return findings, rows.Err()
+}
+
+// FindingGroup collects the findings of one secret across commits, branches
+// and repositories.
+type FindingGroup struct {
+	Fingerprint  string
+	SecretType   string
+	Content      string
+	Status       FindingStatus
+	Count        int
+	LatestID     int64
+	FirstSeen    Finding
+	LastSeen     Finding
+	Repositories []string
+}
+
+// seenBefore orders findings by commit date. Findings stored before commit
+// dates were recorded fall back to the order they were found in.
+func seenBefore(a Finding, b Finding) bool {
+	if !a.CommitTimestamp.IsZero() && !b.CommitTimestamp.IsZero() &&
+		!a.CommitTimestamp.Equal(b.CommitTimestamp) {
+		return a.CommitTimestamp.Before(b.CommitTimestamp)
+	}
+
+	return a.ID < b.ID
+}
+
+// GroupFindings groups the findings selected by query by fingerprint. Limit
+// and Offset apply to the groups, which keep the order of their first
+// finding. A group is unresolved as long as any of its findings is.
+func (s *Scanner) GroupFindings(query FindingQuery) ([]FindingGroup, error) {
+	limit, offset := query.Limit, query.Offset
+	query.Limit, query.Offset = 0, 0
+
+	findings, err := s.QueryFindings(query)
+	if err != nil {
+		return []FindingGroup{}, err
+	}
+
+	groups := []*FindingGroup{}
+	groupsByFingerprint := map[string]*FindingGroup{}
+	for _, finding := range findings {
+		group, ok := groupsByFingerprint[finding.Fingerprint]
+		if !ok {
+			group = &FindingGroup{
+				Fingerprint: finding.Fingerprint,
+				SecretType:  finding.SecretType,
+				Content:     finding.Content,
+				Status:      finding.Status,
+				FirstSeen:   finding,
+				LastSeen:    finding,
+			}
+			groups = append(groups, group)
+			groupsByFingerprint[finding.Fingerprint] = group
+		}
+
+		group.Count++
+		if finding.ID > group.LatestID {
+			group.LatestID = finding.ID
+		}
+		if seenBefore(finding, group.FirstSeen) {
+			group.FirstSeen = finding
+		}
+		if seenBefore(group.LastSeen, finding) {
+			group.LastSeen = finding
+		}
+		if group.Status.IsResolved() && !finding.Status.IsResolved() {
+			group.Status = finding.Status
+		}
+		if !slices.Contains(group.Repositories, finding.Repository) {
+			group.Repositories = append(group.Repositories, finding.Repository)
+		}
+	}
+
+	result := []FindingGroup{}
+	for i, group := range groups {
+		if i < offset || (limit > 0 && len(result) >= limit) {
+			continue
+		}
+		result = append(result, *group)
+	}
+
+	return result, nil
+}
+
+// backfillCommitMetadata adds the commit metadata to findings that were
+// stored before it was recorded, using the mirrors of repos.
+func (s *Scanner) backfillCommitMetadata(repos []Repository) error {
+	for _, repo := range repos {
+		rows, err := s.db.Query(
+			`
+				SELECT DISTINCT commit_hash
+				FROM findings
+				WHERE repository = ?
+					AND (commit_ts IS NULL OR author_name = '')
+			`,
+			repo.URL,
+		)
+		if err != nil {
+			return err
+		}
+
+		commitHashes := []string{}
+		for rows.Next() {
+			var commitHash string
+			err := rows.Scan(&commitHash)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			commitHashes = append(commitHashes, commitHash)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(commitHashes) == 0 {
+			continue
+		}
+
+		gitRepo, err := s.openRepo(repo.URL)
+		if err != nil {
+			log.Printf("Could not open repo %s: %s\n", repo.URL, err)
+			continue
+		}
+
+		for _, commitHash := range commitHashes {
+			commit, err := gitRepo.CommitObject(plumbing.NewHash(commitHash))
+			if err != nil {
+				log.Printf(
+					"Could not find commit %s of repo %s: %s\n",
+					commitHash, repo.URL, err,
+				)
+				continue
+			}
+
+			finding := withCommit(Finding{}, commit)
+			_, err = s.db.Exec(
+				`
+					UPDATE findings
+					SET
+						commit_ts = ?,
+						author_name = ?,
+						author_email = ?,
+						commit_subject = ?
+					WHERE repository = ? AND commit_hash = ?
+				`,
+				finding.CommitTimestamp.UTC(),
+				finding.AuthorName,
+				finding.AuthorEmail,
+				finding.CommitSubject,
+				repo.URL,
+				commitHash,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,349 @@
+package scanner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+const (
+	HookPreCommit = "pre-commit"
+	HookPrePush   = "pre-push"
+
+	hookMarker = "# installed by git-tokens"
+)
+
+var Hooks = []string{HookPreCommit, HookPrePush}
+
+func openCheckout(path string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{
+		DetectDotGit: true,
+	})
+}
+
+// InstallHooks writes pre-commit and pre-push hooks into the repository at
+// path that run "<command> hook run <runFlags>" from dir, so relative paths
+// such as the database resolve as they did when installing. Existing hooks
+// not written by git-tokens are only replaced with force.
+func InstallHooks(
+	path string,
+	dir string,
+	command []string,
+	runFlags []string,
+	force bool,
+) error {
+	repo, err := openCheckout(path)
+	if err != nil {
+		return err
+	}
+
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return fmt.Errorf("repository at %s has no hooks directory", path)
+	}
+	hooksDir := filepath.Join(storage.Filesystem().Root(), "hooks")
+
+	err = os.MkdirAll(hooksDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	quoted := []string{}
+	for _, arg := range command {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	quoted = append(quoted, "hook", "run")
+	for _, arg := range runFlags {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	for _, hook := range Hooks {
+		hookPath := filepath.Join(hooksDir, hook)
+
+		existing, err := os.ReadFile(hookPath)
+		if err == nil && !force && !strings.Contains(string(existing), hookMarker) {
+			return fmt.Errorf("hook %s already exists, use force to replace it", hookPath)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		script := fmt.Sprintf(
+			"#!/bin/sh\n%s\nrepo=\"$(pwd)\"\ncd %s && exec %s %s \"$repo\" \"$@\"\n",
+			hookMarker,
+			shellQuote(dir),
+			strings.Join(quoted, " "),
+			hook,
+		)
+		err = os.WriteFile(hookPath, []byte(script), 0o755)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// stagedLines returns the lines of staged files that are not in the file at
+// HEAD.
+func stagedLines(repo *git.Repository) ([]addedLine, error) {
+	index, err := repo.Storer.Index()
+	if err != nil {
+		return []addedLine{}, err
+	}
+
+	var headTree *object.Tree
+	head, err := repo.Head()
+	if err == nil {
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return []addedLine{}, err
+		}
+		headTree, err = commit.Tree()
+		if err != nil {
+			return []addedLine{}, err
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return []addedLine{}, err
+	}
+
+	lines := []addedLine{}
+	for _, entry := range index.Entries {
+		committed := map[string]bool{}
+		if headTree != nil {
+			file, err := headTree.File(entry.Name)
+			if err == nil && file.Hash == entry.Hash {
+				continue
+			}
+			if err == nil {
+				content, err := file.Contents()
+				if err != nil {
+					return []addedLine{}, err
+				}
+				for _, line := range splitLines(content) {
+					committed[line] = true
+				}
+			}
+		}
+
+		blob, err := repo.BlobObject(entry.Hash)
+		if err != nil {
+			return []addedLine{}, err
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return []addedLine{}, err
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return []addedLine{}, err
+		}
+		if isBinary(content) {
+			continue
+		}
+
+		for i, line := range splitLines(string(content)) {
+			if !committed[line] {
+				lines = append(lines, addedLine{entry.Name, i + 1, line})
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+// hookSecretTypes compiles the secret types hooks check changes against.
+// Without any, a hook would let every change pass, so that is an error.
+func (s *Scanner) hookSecretTypes() ([]compiledSecretType, error) {
+	secretTypes, err := s.compileSecretTypes(ScanOptions{})
+	if err != nil {
+		return []compiledSecretType{}, err
+	}
+
+	if len(secretTypes) == 0 {
+		return []compiledSecretType{}, fmt.Errorf(
+			"no secret types, add them with secret-type import-defaults",
+		)
+	}
+
+	return secretTypes, nil
+}
+
+// CheckStaged runs the secret types against the changes staged in the
+// repository at path. Secrets in baseline are not reported.
+func (s *Scanner) CheckStaged(path string, baseline Baseline) ([]Finding, error) {
+	repo, err := openCheckout(path)
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	secretTypes, err := s.hookSecretTypes()
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	lines, err := stagedLines(repo)
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	findings, _ := matchAddedLines(
+		lines,
+		secretTypes,
+		secretTypes,
+		s.allowedPaths,
+		repoObjectIDs(repo),
+		Finding{TreeName: "index", Repository: path, Status: StatusOpen},
+		false,
+	)
+	findings, _ = baseline.filter(findings)
+
+	return findings, nil
+}
+
+// pushedCommits returns the commits a push sends, read from the ref updates
+// git passes to pre-push hooks on stdin. Commits already on the remote, or
+// on any remote-tracking branch for new remote refs, are left out.
+func pushedCommits(repo *git.Repository, updates io.Reader) ([]*object.Commit, error) {
+	starts := []*object.Commit{}
+	exclude := []*object.Commit{}
+
+	scanner := bufio.NewScanner(updates)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+
+		localHash := plumbing.NewHash(fields[1])
+		remoteHash := plumbing.NewHash(fields[3])
+		if localHash.IsZero() {
+			continue
+		}
+
+		commit, err := repo.CommitObject(localHash)
+		if err != nil {
+			return []*object.Commit{}, err
+		}
+		starts = append(starts, commit)
+
+		if !remoteHash.IsZero() {
+			remoteCommit, err := repo.CommitObject(remoteHash)
+			if err == nil {
+				exclude = append(exclude, remoteCommit)
+			}
+			continue
+		}
+
+		refs, err := repo.References()
+		if err != nil {
+			return []*object.Commit{}, err
+		}
+		err = refs.ForEach(func(ref *plumbing.Reference) error {
+			if ref.Type() != plumbing.HashReference || !ref.Name().IsRemote() {
+				return nil
+			}
+			remoteCommit, err := repo.CommitObject(ref.Hash())
+			if err == nil {
+				exclude = append(exclude, remoteCommit)
+			}
+			return nil
+		})
+		if err != nil {
+			return []*object.Commit{}, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return []*object.Commit{}, err
+	}
+
+	excluded := map[plumbing.Hash]bool{}
+	err := walkCommits(exclude, func(commit *object.Commit) error {
+		excluded[commit.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return []*object.Commit{}, err
+	}
+
+	commits := []*object.Commit{}
+	seen := map[plumbing.Hash]bool{}
+	for _, start := range starts {
+		err := object.NewCommitPreorderIter(start, excluded, nil).ForEach(
+			func(commit *object.Commit) error {
+				if !seen[commit.Hash] {
+					seen[commit.Hash] = true
+					commits = append(commits, commit)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return []*object.Commit{}, err
+		}
+	}
+
+	return commits, nil
+}
+
+// CheckPush runs the secret types against the lines added by the commits
+// of a push to the repository at path. Secrets in baseline are not reported.
+func (s *Scanner) CheckPush(
+	path string,
+	updates io.Reader,
+	baseline Baseline,
+) ([]Finding, error) {
+	repo, err := openCheckout(path)
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	secretTypes, err := s.hookSecretTypes()
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	commits, err := pushedCommits(repo, updates)
+	if err != nil {
+		return []Finding{}, err
+	}
+
+	findings := []Finding{}
+	for _, commit := range commits {
+		lines, err := addedLines(commit)
+		if err != nil {
+			return []Finding{}, err
+		}
+
+		commitFindings, _ := matchAddedLines(
+			lines,
+			secretTypes,
+			secretTypes,
+			s.allowedPaths,
+			repoObjectIDs(repo),
+			withCommit(Finding{
+				TreeName:   commit.Hash.String(),
+				Repository: path,
+				Status:     StatusOpen,
+			}, commit),
+			false,
+		)
+		commitFindings, _ = baseline.filter(commitFindings)
+		findings = append(findings, commitFindings...)
+	}
+
+	return findings, nil
+}
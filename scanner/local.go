@@ -0,0 +1,243 @@
+package scanner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const worktreeTreeName = "worktree"
+
+// localRepoPath returns the absolute path of URL if it names a directory on
+// this machine. Such repositories are opened in place instead of mirrored.
+func localRepoPath(URL string) (string, bool) {
+	info, err := os.Stat(URL)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+
+	path, err := filepath.Abs(URL)
+	if err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// normalizeRepoURL turns local paths into absolute paths, so that a checkout
+// is stored under the same URL no matter where it was added from.
+func normalizeRepoURL(URL string) string {
+	if path, ok := localRepoPath(URL); ok {
+		return path
+	}
+
+	return URL
+}
+
+// openRepo opens a local repository in place, or the mirror of a remote one
+// without fetching it.
+func (s *Scanner) openRepo(repoUrl string) (*git.Repository, error) {
+	if path, ok := localRepoPath(repoUrl); ok {
+		return git.PlainOpen(path)
+	}
+
+	return git.PlainOpen(s.mirrorPath(repoUrl))
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// committedLines returns the lines of fileName at HEAD, if it exists there.
+func committedLines(repo *git.Repository, fileName string) (map[string]bool, error) {
+	lines := map[string]bool{}
+
+	head, err := repo.Head()
+	if err == plumbing.ErrReferenceNotFound {
+		return lines, nil
+	}
+	if err != nil {
+		return lines, err
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return lines, err
+	}
+
+	file, err := commit.File(fileName)
+	if err == object.ErrFileNotFound {
+		return lines, nil
+	}
+	if err != nil {
+		return lines, err
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return lines, err
+	}
+
+	for _, line := range splitLines(content) {
+		lines[line] = true
+	}
+
+	return lines, nil
+}
+
+// scanWorktree scans the lines of a checkout that are changed or untracked
+// compared to HEAD. Findings are returned instead of stored, as they belong
+// to no commit.
+func scanWorktree(
+	repo *git.Repository,
+	repoUrl string,
+	secretTypes []compiledSecretType,
+	allowedPaths pathAllowlist,
+	options ScanOptions,
+) ([]Finding, map[string]int, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return []Finding{}, nil, err
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return []Finding{}, nil, err
+	}
+
+	fileNames := []string{}
+	for fileName := range status {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	objects := repoObjectIDs(repo)
+	now := time.Now()
+	findings := []Finding{}
+	suppressed := map[string]int{}
+	for _, fileName := range fileNames {
+		fileStatus := status[fileName]
+		if fileStatus.Worktree == git.Deleted ||
+			(fileStatus.Worktree == git.Unmodified &&
+				fileStatus.Staging == git.Unmodified) {
+			continue
+		}
+
+		content, err := os.ReadFile(
+			filepath.Join(worktree.Filesystem.Root(), fileName),
+		)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return []Finding{}, nil, err
+		}
+		if isBinary(content) {
+			continue
+		}
+
+		committed, err := committedLines(repo, fileName)
+		if err != nil {
+			return []Finding{}, nil, err
+		}
+
+		for i, line := range splitLines(string(content)) {
+			if committed[line] {
+				continue
+			}
+
+			for _, secretType := range secretTypes {
+				matched, reason := matchLine(
+					secretType,
+					allowedPaths,
+					objects,
+					fileName,
+					line,
+				)
+				if !matched {
+					continue
+				}
+				if reason != "" {
+					suppressed[reason]++
+					continue
+				}
+
+				finding := secretType.redactFinding(Finding{
+					LastScannedTimestamp: now,
+					FileName:             fileName,
+					LineNumber:           i + 1,
+					Content:              line,
+					TreeName:             worktreeTreeName,
+					Repository:           repoUrl,
+					SecretType:           secretType.Name,
+					Status:               StatusOpen,
+				}, secretTypes, options.ShowSecrets)
+				if options.Baseline.contains(finding) {
+					suppressed[SuppressedBaseline]++
+					continue
+				}
+
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	return findings, suppressed, nil
+}
+
+// ScanPath scans the history of the checkout at dir, adding it as a
+// repository if needed, and returns the findings in its uncommitted and
+// untracked files. The summary covers both the history and the worktree.
+func (s *Scanner) ScanPath(
+	dir string,
+	options ScanOptions,
+) ([]Finding, ScanSummary, error) {
+	path, ok := localRepoPath(dir)
+	if !ok {
+		return []Finding{}, ScanSummary{}, os.ErrNotExist
+	}
+
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return []Finding{}, ScanSummary{}, err
+	}
+
+	err = s.AddRepo(path)
+	if err != nil {
+		return []Finding{}, ScanSummary{}, err
+	}
+
+	summary, err := s.scanRepos([]Repository{{path}}, options)
+	if err != nil {
+		return []Finding{}, summary, err
+	}
+
+	secretTypes, err := s.compileSecretTypes(options)
+	if err != nil {
+		return []Finding{}, summary, err
+	}
+
+	findings, suppressed, err := scanWorktree(
+		repo,
+		path,
+		secretTypes,
+		s.allowedPaths,
+		options,
+	)
+	if err != nil {
+		return []Finding{}, summary, err
+	}
+
+	summary = summary.add(ScanSummary{
+		Findings:   len(findings),
+		Suppressed: suppressed,
+	})
+
+	return findings, summary, nil
+}
@@ -0,0 +1,824 @@
+package scanner
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"os"
+)
+
+type Migration struct {
+	Version     int
+	Description string
+	apply       func(tx *sql.Tx) error
+}
+
+// migrations are applied in order and each one exactly once. Databases
+// created before schema versioning was introduced start at version 0, so
+// every migration must also cope with tables it may already find in their
+// final shape.
+var migrations = []Migration{
+	{
+		1,
+		"Create repositories, secret_types, scanned_commits and findings tables",
+		migrateCreateTables,
+	},
+	{
+		2,
+		"Key findings by repository, commit, file, line and secret type",
+		migrateFindingsPrimaryKey,
+	},
+	{
+		3,
+		"Add description and version to secret_types",
+		migrateSecretTypeDescriptionAndVersion,
+	},
+	{
+		4,
+		"Add severity and allowlist to secret_types",
+		migrateSecretTypeSeverityAndAllowlist,
+	},
+	{
+		5,
+		"Add entropy threshold and secret group to secret_types",
+		migrateSecretTypeEntropy,
+	},
+	{
+		6,
+		"Add rescan marker to secret_types",
+		migrateSecretTypeRescanAfter,
+	},
+	{
+		7,
+		"Add id, status, assignee and note to findings",
+		migrateFindingTriage,
+	},
+	{
+		8,
+		"Redact secrets in findings and add secret_hash and raw_content",
+		migrateRedactFindings,
+	},
+	{
+		9,
+		"Add fingerprint and commit_ts to findings",
+		migrateFindingFingerprint,
+	},
+	{
+		10,
+		"Add author_name, author_email and commit_subject to findings",
+		migrateFindingCommitMetadata,
+	},
+	{
+		11,
+		"Create scanned_blobs table",
+		migrateCreateScannedBlobs,
+	},
+	{
+		12,
+		"Track the secret type versions each commit was scanned with",
+		migrateScannedCommitRules,
+	},
+	{
+		13,
+		"Create failed_commits table",
+		migrateCreateFailedCommits,
+	},
+	{
+		14,
+		"Redact secrets of all secret types in findings",
+		migrateMaskFindings,
+	},
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func tableExists(q queryer, table string) (bool, error) {
+	rows, err := q.Query(
+		`
+			SELECT name
+			FROM sqlite_master
+			WHERE type = 'table' AND name = ?
+		`,
+		table,
+	)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+func tableHasColumn(q queryer, table string, column string) (bool, error) {
+	rows, err := q.Query(
+		`
+			SELECT name
+			FROM pragma_table_info(?)
+		`,
+		table,
+	)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		err := rows.Scan(&name)
+		if err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func schemaVersion(q queryer) (int, error) {
+	exists, err := tableExists(q, "schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	rows, err := q.Query(
+		`
+			SELECT COALESCE(MAX(version), 0)
+			FROM schema_version
+		`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	version := 0
+	if rows.Next() {
+		err = rows.Scan(&version)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return version, rows.Err()
+}
+
+func pendingMigrations(q queryer) ([]Migration, error) {
+	version, err := schemaVersion(q)
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	pending := []Migration{}
+	for _, migration := range migrations {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// PendingMigrations opens the database without modifying it and returns the
+// migrations NewScanner would apply to it. A database that does not exist yet
+// is not created, all migrations are pending for it.
+func PendingMigrations(DBType string, DBPath string) ([]Migration, error) {
+	_, err := os.Stat(DBPath)
+	if os.IsNotExist(err) {
+		return migrations, nil
+	}
+	if err != nil {
+		return []Migration{}, err
+	}
+
+	db, err := sql.Open(DBType, DBPath)
+	if err != nil {
+		return []Migration{}, err
+	}
+	defer db.Close()
+
+	return pendingMigrations(db)
+}
+
+func (s *Scanner) SchemaVersion() (int, error) {
+	return schemaVersion(s.db)
+}
+
+func (s *Scanner) Migrate() error {
+	_, err := s.db.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS schema_version (
+				version INT NOT NULL PRIMARY KEY,
+				description TEXT NOT NULL,
+				applied_ts TIMESTAMP NOT NULL
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	pending, err := pendingMigrations(s.db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		log.Printf(
+			"Applying migration %d: %s\n",
+			migration.Version, migration.Description,
+		)
+
+		err := s.applyMigration(migration)
+		if err != nil {
+			log.Printf(
+				"Could not apply migration %d: %s\n",
+				migration.Version, err,
+			)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scanner) applyMigration(migration Migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = migration.apply(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			INSERT INTO schema_version (version, description, applied_ts)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`,
+		migration.Version,
+		migration.Description,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func migrateCreateTables(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS repositories (
+				url TEXT NOT NULL PRIMARY KEY
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS secret_types (
+				name TEXT NOT NULL PRIMARY KEY,
+				regex TEXT NOT NULL
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS scanned_commits (
+				repository TEXT NOT NULL,
+				commit_hash TEXT NOT NULL,
+				last_scanned_ts TIMESTAMP NOT NULL,
+				PRIMARY KEY (repository, commit_hash)
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS findings (
+				last_scanned_ts TIMESTAMP NOT NULL,
+				file_name TEXT NOT NULL,
+				line_number INT NOT NULL,
+				content TEXT NOT NULL,
+				tree_name TEXT NOT NULL,
+				repository TEXT NOT NULL,
+				secret_type TEXT NOT NULL,
+				FOREIGN KEY (secret_type) REFERENCES secret_type(type),
+				FOREIGN KEY (repository) REFERENCES repositories(url),
+				PRIMARY KEY (repository, tree_name)
+			)
+		`,
+	)
+
+	return err
+}
+
+// migrateFindingsPrimaryKey rebuilds a findings table created with the old
+// (repository, tree_name) primary key, which kept only the first match of
+// every commit. The tree name of existing rows is the commit hash.
+func migrateFindingsPrimaryKey(tx *sql.Tx) error {
+	hasCommitHash, err := tableHasColumn(tx, "findings", "commit_hash")
+	if err != nil || hasCommitHash {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE findings RENAME TO findings_old`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			CREATE TABLE findings (
+				last_scanned_ts TIMESTAMP NOT NULL,
+				file_name TEXT NOT NULL,
+				line_number INT NOT NULL,
+				content TEXT NOT NULL,
+				tree_name TEXT NOT NULL,
+				commit_hash TEXT NOT NULL,
+				repository TEXT NOT NULL,
+				secret_type TEXT NOT NULL,
+				FOREIGN KEY (secret_type) REFERENCES secret_types(name),
+				FOREIGN KEY (repository) REFERENCES repositories(url),
+				PRIMARY KEY (
+					repository,
+					commit_hash,
+					file_name,
+					line_number,
+					secret_type
+				)
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			INSERT OR IGNORE INTO findings (
+				last_scanned_ts,
+				file_name,
+				line_number,
+				content,
+				tree_name,
+				commit_hash,
+				repository,
+				secret_type
+			)
+			SELECT
+				last_scanned_ts,
+				file_name,
+				line_number,
+				content,
+				tree_name,
+				tree_name,
+				repository,
+				secret_type
+			FROM findings_old
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP TABLE findings_old`)
+
+	return err
+}
+
+func migrateSecretTypeDescriptionAndVersion(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN description TEXT NOT NULL DEFAULT ''`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN version INT NOT NULL DEFAULT 0`,
+	)
+
+	return err
+}
+
+func migrateSecretTypeSeverityAndAllowlist(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN severity TEXT NOT NULL DEFAULT ''`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN allowlist TEXT NOT NULL DEFAULT '[]'`,
+	)
+
+	return err
+}
+
+func migrateSecretTypeEntropy(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN entropy REAL NOT NULL DEFAULT 0`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN secret_group INT NOT NULL DEFAULT 0`,
+	)
+
+	return err
+}
+
+func migrateSecretTypeRescanAfter(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`ALTER TABLE secret_types ADD COLUMN rescan_after_ts TIMESTAMP`,
+	)
+
+	return err
+}
+
+func migrateFindingTriage(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE findings RENAME TO findings_old`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			CREATE TABLE findings (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				last_scanned_ts TIMESTAMP NOT NULL,
+				file_name TEXT NOT NULL,
+				line_number INT NOT NULL,
+				content TEXT NOT NULL,
+				tree_name TEXT NOT NULL,
+				commit_hash TEXT NOT NULL,
+				repository TEXT NOT NULL,
+				secret_type TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'open',
+				assignee TEXT NOT NULL DEFAULT '',
+				note TEXT NOT NULL DEFAULT '',
+				FOREIGN KEY (secret_type) REFERENCES secret_types(name),
+				FOREIGN KEY (repository) REFERENCES repositories(url),
+				UNIQUE (
+					repository,
+					commit_hash,
+					file_name,
+					line_number,
+					secret_type
+				)
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`
+			INSERT INTO findings (
+				last_scanned_ts,
+				file_name,
+				line_number,
+				content,
+				tree_name,
+				commit_hash,
+				repository,
+				secret_type
+			)
+			SELECT
+				last_scanned_ts,
+				file_name,
+				line_number,
+				content,
+				tree_name,
+				commit_hash,
+				repository,
+				secret_type
+			FROM findings_old
+			ORDER BY last_scanned_ts
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP TABLE findings_old`)
+
+	return err
+}
+
+func migrationSecretTypes(tx *sql.Tx) (map[string]compiledSecretType, error) {
+	rows, err := tx.Query(
+		`SELECT name, regex, allowlist, entropy, secret_group FROM secret_types`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	secretTypes := map[string]compiledSecretType{}
+	for _, secretType := range HighEntropySecretTypes() {
+		compiled, err := compileSecretType(secretType)
+		if err != nil {
+			return nil, err
+		}
+		secretTypes[secretType.Name] = compiled
+	}
+
+	for rows.Next() {
+		secretType := SecretType{}
+		allowlist := ""
+		err := rows.Scan(
+			&secretType.Name,
+			&secretType.Regex,
+			&allowlist,
+			&secretType.Entropy,
+			&secretType.SecretGroup,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal([]byte(allowlist), &secretType.Allowlist)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled, err := compileSecretType(secretType)
+		if err != nil {
+			continue
+		}
+		secretTypes[secretType.Name] = compiled
+	}
+
+	return secretTypes, rows.Err()
+}
+
+type migrationFinding struct {
+	id         int64
+	content    string
+	secretType string
+}
+
+func migrationFindings(tx *sql.Tx) ([]migrationFinding, error) {
+	rows, err := tx.Query(`SELECT id, content, secret_type FROM findings`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []migrationFinding{}
+	for rows.Next() {
+		finding := migrationFinding{}
+		err := rows.Scan(&finding.id, &finding.content, &finding.secretType)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings, rows.Err()
+}
+
+// migrateRedactFindings redacts the content of existing findings by running
+// their secret type again. Lines of unknown secret types are redacted as a
+// whole.
+func migrateRedactFindings(tx *sql.Tx) error {
+	for _, column := range []string{"secret_hash", "raw_content"} {
+		_, err := tx.Exec(
+			`ALTER TABLE findings ADD COLUMN ` + column +
+				` TEXT NOT NULL DEFAULT ''`,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	secretTypes, err := migrationSecretTypes(tx)
+	if err != nil {
+		return err
+	}
+
+	findings, err := migrationFindings(tx)
+	if err != nil {
+		return err
+	}
+
+	allSecretTypes := []compiledSecretType{}
+	for _, secretType := range secretTypes {
+		allSecretTypes = append(allSecretTypes, secretType)
+	}
+
+	for _, finding := range findings {
+		content, secretHash := redactSecret(finding.content), hashSecret(finding.content)
+		if secretType, ok := secretTypes[finding.secretType]; ok {
+			content, secretHash = secretType.redact(finding.content, allSecretTypes)
+		}
+
+		_, err := tx.Exec(
+			`UPDATE findings SET content = ?, secret_hash = ? WHERE id = ?`,
+			content,
+			secretHash,
+			finding.id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func migrateFindingFingerprint(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`ALTER TABLE findings ADD COLUMN fingerprint TEXT NOT NULL DEFAULT ''`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE findings ADD COLUMN commit_ts TIMESTAMP`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(
+		`SELECT DISTINCT secret_type, secret_hash FROM findings`,
+	)
+	if err != nil {
+		return err
+	}
+
+	secrets := [][2]string{}
+	for rows.Next() {
+		secret := [2]string{}
+		err := rows.Scan(&secret[0], &secret[1])
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		secrets = append(secrets, secret)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, secret := range secrets {
+		_, err := tx.Exec(
+			`
+				UPDATE findings
+				SET fingerprint = ?
+				WHERE secret_type = ? AND secret_hash = ?
+			`,
+			fingerprint(secret[0], secret[1]),
+			secret[0],
+			secret[1],
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`CREATE INDEX findings_fingerprint ON findings (fingerprint)`,
+	)
+
+	return err
+}
+
+func migrateFindingCommitMetadata(tx *sql.Tx) error {
+	for _, column := range []string{
+		"author_name",
+		"author_email",
+		"commit_subject",
+	} {
+		_, err := tx.Exec(
+			`ALTER TABLE findings ADD COLUMN ` + column +
+				` TEXT NOT NULL DEFAULT ''`,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateCreateScannedBlobs adds the cache of blobs matched with a set of
+// secret types. matches holds the matching lines as JSON.
+func migrateCreateScannedBlobs(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS scanned_blobs (
+				blob_hash TEXT NOT NULL,
+				rule_version TEXT NOT NULL,
+				matches TEXT NOT NULL DEFAULT '[]',
+				PRIMARY KEY (blob_hash, rule_version)
+			)
+		`,
+	)
+
+	return err
+}
+
+// migrateScannedCommitRules replaces the rescan marker of secret types with
+// the versions of the secret types each commit was scanned with. Which
+// secret types were applied to already scanned commits is unknown, so the
+// next scan checks them against every secret type once.
+func migrateScannedCommitRules(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS scanned_commit_rules (
+				repository TEXT NOT NULL,
+				commit_hash TEXT NOT NULL,
+				secret_type TEXT NOT NULL,
+				rule_version TEXT NOT NULL,
+				PRIMARY KEY (repository, commit_hash, secret_type)
+			)
+		`,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE secret_types DROP COLUMN rescan_after_ts`)
+
+	return err
+}
+
+func migrateCreateFailedCommits(tx *sql.Tx) error {
+	_, err := tx.Exec(
+		`
+			CREATE TABLE IF NOT EXISTS failed_commits (
+				repository TEXT NOT NULL,
+				commit_hash TEXT NOT NULL,
+				error TEXT NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				last_attempt_ts TIMESTAMP NOT NULL,
+				PRIMARY KEY (repository, commit_hash)
+			)
+		`,
+	)
+
+	return err
+}
+
+// migrateMaskFindings redacts secrets left in plaintext on finding lines that
+// hold secrets of several secret types. Only the secret of the finding's own
+// secret type was redacted before, so secret hashes stay as they are.
+func migrateMaskFindings(tx *sql.Tx) error {
+	secretTypes, err := migrationSecretTypes(tx)
+	if err != nil {
+		return err
+	}
+
+	allSecretTypes := []compiledSecretType{}
+	for _, secretType := range secretTypes {
+		allSecretTypes = append(allSecretTypes, secretType)
+	}
+
+	findings, err := migrationFindings(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, finding := range findings {
+		content := maskSecrets(finding.content, allSecretTypes)
+		if content == finding.content {
+			continue
+		}
+
+		_, err := tx.Exec(
+			`UPDATE findings SET content = ? WHERE id = ?`,
+			content,
+			finding.id,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
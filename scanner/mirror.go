@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// mirrorName derives the cache directory name of a repository from its URL.
+// The repoDirPattern works like the pattern of os.MkdirTemp, except that the
+// last "*" is replaced by a hash of the URL instead of a random string.
+func (s *Scanner) mirrorName(repoUrl string) string {
+	sum := sha256.Sum256([]byte(repoUrl))
+	prefix, suffix := s.mirrorNameAffixes()
+
+	return prefix + hex.EncodeToString(sum[:]) + suffix
+}
+
+func (s *Scanner) mirrorNameAffixes() (string, string) {
+	if i := strings.LastIndex(s.repoDirPattern, "*"); i >= 0 {
+		return s.repoDirPattern[:i], s.repoDirPattern[i+1:]
+	}
+
+	return s.repoDirPattern, ""
+}
+
+func (s *Scanner) isMirrorName(name string) bool {
+	prefix, suffix := s.mirrorNameAffixes()
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return false
+	}
+
+	key := strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix)
+	decoded, err := hex.DecodeString(key)
+
+	return err == nil && len(decoded) == sha256.Size
+}
+
+func (s *Scanner) mirrorPath(repoUrl string) string {
+	return filepath.Join(s.workingDirectory, s.mirrorName(repoUrl))
+}
+
+// openMirror updates and opens the mirror of a remote repository. Local
+// repositories are opened in place.
+func (s *Scanner) openMirror(repoUrl string) (*git.Repository, error) {
+	if path, ok := localRepoPath(repoUrl); ok {
+		return git.PlainOpen(path)
+	}
+
+	dir := s.mirrorPath(repoUrl)
+
+	auth, err := s.authFor(repoUrl)
+	if err != nil {
+		return nil, fmt.Errorf("could not get credentials: %w", err)
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err == git.ErrRepositoryNotExists {
+		log.Printf("Cloning repo %s into %s\n", repoUrl, dir)
+		repo, err = git.PlainClone(dir, true, &git.CloneOptions{
+			URL:    repoUrl,
+			Auth:   auth,
+			Mirror: true,
+		})
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		log.Printf("Done cloning repo %s into %s\n", repoUrl, dir)
+
+		return repo, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Fetching repo %s into %s\n", repoUrl, dir)
+	err = repo.Fetch(&git.FetchOptions{
+		Auth:  auth,
+		Force: true,
+		Tags:  git.AllTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+	log.Printf("Done fetching repo %s into %s\n", repoUrl, dir)
+
+	return repo, nil
+}
+
+func (s *Scanner) removeMirror(repoUrl string) error {
+	return os.RemoveAll(s.mirrorPath(repoUrl))
+}
+
+// PruneMirrors removes cached mirrors of repositories that are no longer in
+// the database.
+func (s *Scanner) PruneMirrors() error {
+	repos, err := s.GetRepos()
+	if err != nil {
+		return err
+	}
+
+	knownMirrors := map[string]bool{}
+	for _, repo := range repos {
+		if _, ok := localRepoPath(repo.URL); ok {
+			continue
+		}
+		knownMirrors[s.mirrorName(repo.URL)] = true
+	}
+
+	entries, err := os.ReadDir(s.workingDirectory)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || knownMirrors[name] || !s.isMirrorName(name) {
+			continue
+		}
+
+		dir := filepath.Join(s.workingDirectory, name)
+		log.Printf("Removing mirror %s\n", dir)
+		err := os.RemoveAll(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+const redactionMask = "****"
+
+// redactSecret keeps up to four characters at either end of secret, but
+// never more than a quarter of it on each side.
+func redactSecret(secret string) string {
+	keep := min(len(secret)/4, 4)
+
+	return secret[:keep] + redactionMask + secret[len(secret)-keep:]
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// maskSecrets replaces the secrets of every one of secretTypes on line with
+// their redacted form, so a line holding several kinds of secrets does not
+// keep the ones another secret type reports in plaintext.
+func maskSecrets(line string, secretTypes []compiledSecretType) string {
+	type span struct{ start, end int }
+
+	spans := []span{}
+	for _, secretType := range secretTypes {
+		for _, match := range secretType.findSecrets(line) {
+			if match.Suppressed == "" && match.end > match.start {
+				spans = append(spans, span{match.start, match.end})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return line
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	merged := []span{spans[0]}
+	for _, next := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if next.start < last.end {
+			last.end = max(last.end, next.end)
+			continue
+		}
+		merged = append(merged, next)
+	}
+
+	var masked strings.Builder
+	last := 0
+	for _, span := range merged {
+		masked.WriteString(line[last:span.start])
+		masked.WriteString(redactSecret(line[span.start:span.end]))
+		last = span.end
+	}
+	masked.WriteString(line[last:])
+
+	return masked.String()
+}
+
+// redact masks the secrets of c and of every one of secretTypes on line
+// and returns the hash of the first secret of c, which identifies the
+// finding.
+func (c compiledSecretType) redact(
+	line string,
+	secretTypes []compiledSecretType,
+) (string, string) {
+	secretHash := ""
+	for _, match := range c.findSecrets(line) {
+		if match.Suppressed == "" {
+			secretHash = hashSecret(match.Secret)
+			break
+		}
+	}
+
+	if secretHash == "" {
+		return redactSecret(line), hashSecret(line)
+	}
+
+	return maskSecrets(line, append([]compiledSecretType{c}, secretTypes...)), secretHash
+}
+
+// redactFinding fills in the redacted content and secret hash of a finding
+// from its raw line, masking the secrets of all secretTypes of the scan. The
+// raw line is only kept if showSecrets is set.
+func (c compiledSecretType) redactFinding(
+	finding Finding,
+	secretTypes []compiledSecretType,
+	showSecrets bool,
+) Finding {
+	rawContent := finding.Content
+	finding.Content, finding.SecretHash = c.redact(rawContent, secretTypes)
+	if showSecrets {
+		finding.RawContent = rawContent
+	}
+
+	return finding
+}
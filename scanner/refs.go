@@ -0,0 +1,136 @@
+package scanner
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+const (
+	branchRefPattern = "refs/heads/*"
+	tagRefPattern    = "refs/tags/*"
+)
+
+// refPatterns returns the ref globs a scan walks. Without any ref options
+// only HEAD is scanned and the result is empty.
+func (o ScanOptions) refPatterns() []string {
+	patterns := []string{}
+	if o.Branches {
+		patterns = append(patterns, branchRefPattern)
+	}
+	if o.Tags {
+		patterns = append(patterns, tagRefPattern)
+	}
+
+	return append(patterns, o.Refs...)
+}
+
+// matchesRef matches name against patterns. A trailing "/*" matches all refs
+// below that prefix, including nested ones such as refs/heads/release/1.0.
+func matchesRef(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if strings.HasSuffix(pattern, "/*") &&
+			strings.HasPrefix(name, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peelToCommit resolves a ref hash to a commit, following annotated tags.
+// Tags pointing to trees or blobs yield nil.
+func peelToCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	for {
+		tag, err := repo.TagObject(hash)
+		if err == plumbing.ErrObjectNotFound {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tag.TargetType != plumbing.CommitObject &&
+			tag.TargetType != plumbing.TagObject {
+			return nil, nil
+		}
+		hash = tag.Target
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err == plumbing.ErrObjectNotFound {
+		return nil, nil
+	}
+
+	return commit, err
+}
+
+// startCommits returns the commits a scan starts walking from: HEAD, or the
+// tips of all refs matching the ref options, without duplicates.
+func startCommits(repo *git.Repository, options ScanOptions) ([]*object.Commit, error) {
+	patterns := options.refPatterns()
+	if len(patterns) == 0 {
+		ref, err := repo.Head()
+		if err != nil {
+			return []*object.Commit{}, err
+		}
+
+		commit, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return []*object.Commit{}, err
+		}
+
+		return []*object.Commit{commit}, nil
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return []*object.Commit{}, err
+	}
+
+	commits := []*object.Commit{}
+	seen := map[plumbing.Hash]bool{}
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference ||
+			!matchesRef(ref.Name().String(), patterns) {
+			return nil
+		}
+
+		commit, err := peelToCommit(repo, ref.Hash())
+		if err != nil || commit == nil || seen[commit.Hash] {
+			return err
+		}
+
+		seen[commit.Hash] = true
+		commits = append(commits, commit)
+
+		return nil
+	})
+
+	return commits, err
+}
+
+// walkCommits calls fn once for every commit reachable from any of the start
+// commits.
+func walkCommits(starts []*object.Commit, fn func(*object.Commit) error) error {
+	seen := map[plumbing.Hash]bool{}
+	for _, start := range starts {
+		err := object.NewCommitPreorderIter(start, seen, nil).ForEach(
+			func(commit *object.Commit) error {
+				seen[commit.Hash] = true
+				return fn(commit)
+			},
+		)
+		if err != nil && err != storer.ErrStop {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestMatchesRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{"refs/heads/main", []string{branchRefPattern}, true},
+		{"refs/heads/release/1.0", []string{branchRefPattern}, true},
+		{"refs/tags/v1.0", []string{branchRefPattern}, false},
+		{"refs/tags/v1.0", []string{branchRefPattern, tagRefPattern}, true},
+		{"refs/heads/release/1.0", []string{"refs/heads/release/*"}, true},
+		{"refs/heads/main", []string{"refs/heads/release/*"}, false},
+		{"refs/heads/release-1.0", []string{"refs/heads/release-*"}, true},
+		{"refs/heads/release-1.0/fix", []string{"refs/heads/release-*"}, false},
+		{"refs/heads/main", []string{"refs/heads/main"}, true},
+		{"refs/heads/main", []string{}, false},
+	}
+
+	for _, test := range tests {
+		if got := matchesRef(test.name, test.patterns); got != test.want {
+			t.Errorf(
+				"matchesRef(%q, %q) = %t, want %t",
+				test.name, test.patterns, got, test.want,
+			)
+		}
+	}
+}
+
+func TestWalkCommits(t *testing.T) {
+	s := memory.NewStorage()
+
+	root := storeCommit(t, s, map[string]string{"a": "root\n"})
+	left := storeCommit(t, s, map[string]string{"a": "left\n"}, root)
+	right := storeCommit(t, s, map[string]string{"a": "right\n"}, root)
+	merge := storeCommit(t, s, map[string]string{"a": "merge\n"}, left, right)
+	other := storeCommit(t, s, map[string]string{"b": "other\n"})
+
+	tests := []struct {
+		name   string
+		starts []*object.Commit
+		want   []plumbing.Hash
+	}{
+		{"root", []*object.Commit{root}, []plumbing.Hash{root.Hash}},
+		{
+			"merge reaches both parents once",
+			[]*object.Commit{merge},
+			[]plumbing.Hash{merge.Hash, left.Hash, right.Hash, root.Hash},
+		},
+		{
+			"shared history is walked once",
+			[]*object.Commit{left, right},
+			[]plumbing.Hash{left.Hash, root.Hash, right.Hash},
+		},
+		{
+			"unrelated histories",
+			[]*object.Commit{left, other},
+			[]plumbing.Hash{left.Hash, root.Hash, other.Hash},
+		},
+		{"no start commits", []*object.Commit{}, []plumbing.Hash{}},
+	}
+
+	for _, test := range tests {
+		got := []plumbing.Hash{}
+		err := walkCommits(test.starts, func(commit *object.Commit) error {
+			got = append(got, commit.Hash)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		sortHashes(got)
+		sortHashes(test.want)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: walked %v, want %v", test.name, got, test.want)
+		}
+	}
+}
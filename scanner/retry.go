@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"log"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// addFailedCommit records a commit that could not be scanned or stored, so
+// the next scan of its repository retries it even if it is no longer
+// reachable from the refs scanned then.
+func (s *Scanner) addFailedCommit(repoUrl string, hash string, scanErr error) error {
+	_, err := s.db.Exec(
+		`
+			INSERT INTO failed_commits (
+				repository,
+				commit_hash,
+				error,
+				attempts,
+				last_attempt_ts
+			)
+			VALUES (?, ?, ?, 1, CURRENT_TIMESTAMP)
+			ON CONFLICT (repository, commit_hash) DO UPDATE SET
+				error = excluded.error,
+				attempts = failed_commits.attempts + 1,
+				last_attempt_ts = excluded.last_attempt_ts
+		`,
+		repoUrl, hash, scanErr.Error(),
+	)
+
+	return err
+}
+
+func removeFailedCommit(q execQueryer, repoUrl string, hash string) error {
+	_, err := q.Exec(
+		`
+			DELETE FROM failed_commits
+			WHERE repository = ? AND commit_hash = ?
+		`,
+		repoUrl, hash,
+	)
+
+	return err
+}
+
+func (s *Scanner) failedCommits(repoUrl string) ([]string, error) {
+	rows, err := s.db.Query(
+		`
+			SELECT commit_hash
+			FROM failed_commits
+			WHERE repository = ?
+			ORDER BY last_attempt_ts
+		`,
+		repoUrl,
+	)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		err := rows.Scan(&hash)
+		if err != nil {
+			return []string{}, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+// failedCommitsToRetry returns the failed commits of a repository that the
+// walk of its refs did not reach.
+func (s *Scanner) failedCommitsToRetry(
+	repoUrl string,
+	repo *git.Repository,
+	visited map[plumbing.Hash]bool,
+) ([]*object.Commit, error) {
+	hashes, err := s.failedCommits(repoUrl)
+	if err != nil {
+		return []*object.Commit{}, err
+	}
+
+	commits := []*object.Commit{}
+	for _, hash := range hashes {
+		if visited[plumbing.NewHash(hash)] {
+			continue
+		}
+
+		commit, err := repo.CommitObject(plumbing.NewHash(hash))
+		if err != nil {
+			log.Printf(
+				"Could not retry repo %s, commit %s: %s\n",
+				repoUrl, hash, err,
+			)
+			continue
+		}
+		commits = append(commits, commit)
+	}
+
+	return commits, nil
+}
@@ -0,0 +1,84 @@
+package scanner
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func sortHashes(hashes []plumbing.Hash) {
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].String() < hashes[j].String()
+	})
+}
+
+func TestFailedCommitsToRetry(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := storeCommit(t, repo.Storer, map[string]string{"a": "a\n"})
+	child := storeCommit(t, repo.Storer, map[string]string{"a": "b\n"}, root)
+	missing := "0123456789abcdef0123456789abcdef01234567"
+
+	s := newTestScanner(t)
+	for _, hash := range []string{root.Hash.String(), child.Hash.String(), missing} {
+		err := s.addFailedCommit("repo", hash, errors.New("failed"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		visited map[plumbing.Hash]bool
+		want    []plumbing.Hash
+	}{
+		{
+			"unreachable commits are retried",
+			map[plumbing.Hash]bool{},
+			[]plumbing.Hash{root.Hash, child.Hash},
+		},
+		{
+			"visited commits are not retried twice",
+			map[plumbing.Hash]bool{root.Hash: true},
+			[]plumbing.Hash{child.Hash},
+		},
+		{
+			"all visited",
+			map[plumbing.Hash]bool{root.Hash: true, child.Hash: true},
+			[]plumbing.Hash{},
+		},
+	}
+
+	for _, test := range tests {
+		commits, err := s.failedCommitsToRetry("repo", repo, test.visited)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		got := []plumbing.Hash{}
+		for _, commit := range commits {
+			got = append(got, commit.Hash)
+		}
+		sortHashes(got)
+		sortHashes(test.want)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: retried %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	other, err := s.failedCommitsToRetry("other", repo, map[plumbing.Hash]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 0 {
+		t.Errorf("retried %d commits of another repository, want 0", len(other))
+	}
+}
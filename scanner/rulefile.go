@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type ruleFile struct {
+	SecretTypes []ruleFileSecretType `yaml:"secret_types" toml:"secret_types"`
+}
+
+type ruleFileSecretType struct {
+	Name        string   `yaml:"name" toml:"name"`
+	Regex       string   `yaml:"regex" toml:"regex"`
+	Description string   `yaml:"description,omitempty" toml:"description,omitempty"`
+	Severity    string   `yaml:"severity,omitempty" toml:"severity,omitempty"`
+	Version     int      `yaml:"version,omitempty" toml:"version,omitempty"`
+	Allowlist   []string `yaml:"allowlist,omitempty" toml:"allowlist,omitempty"`
+	Entropy     float64  `yaml:"entropy,omitempty" toml:"entropy,omitempty"`
+	SecretGroup int      `yaml:"secret_group,omitempty" toml:"secret_group,omitempty"`
+}
+
+// gitleaksConfig is the subset of a gitleaks configuration that maps onto
+// secret types. Rules without a regex, such as path-only rules, are skipped.
+type gitleaksConfig struct {
+	Rules []struct {
+		ID          string            `toml:"id"`
+		Description string            `toml:"description"`
+		Regex       string            `toml:"regex"`
+		Entropy     float64           `toml:"entropy"`
+		SecretGroup int               `toml:"secretGroup"`
+		Allowlist   gitleaksAllowlist `toml:"allowlist"`
+	} `toml:"rules"`
+	Allowlist gitleaksAllowlist `toml:"allowlist"`
+}
+
+type gitleaksAllowlist struct {
+	Regexes []string `toml:"regexes"`
+}
+
+func (r ruleFileSecretType) secretType() SecretType {
+	return SecretType{
+		Name:        r.Name,
+		Regex:       r.Regex,
+		Description: r.Description,
+		Version:     r.Version,
+		Severity:    r.Severity,
+		Allowlist:   r.Allowlist,
+		Entropy:     r.Entropy,
+		SecretGroup: r.SecretGroup,
+	}
+}
+
+func parseYAMLSecretTypes(data []byte) ([]SecretType, error) {
+	file := ruleFile{}
+	err := yaml.Unmarshal(data, &file)
+	if err != nil {
+		return []SecretType{}, err
+	}
+
+	secretTypes := []SecretType{}
+	for _, secretType := range file.SecretTypes {
+		secretTypes = append(secretTypes, secretType.secretType())
+	}
+
+	return secretTypes, nil
+}
+
+func parseTOMLSecretTypes(data []byte) ([]SecretType, error) {
+	file := ruleFile{}
+	err := toml.Unmarshal(data, &file)
+	if err != nil {
+		return []SecretType{}, err
+	}
+
+	if len(file.SecretTypes) > 0 {
+		secretTypes := []SecretType{}
+		for _, secretType := range file.SecretTypes {
+			secretTypes = append(secretTypes, secretType.secretType())
+		}
+
+		return secretTypes, nil
+	}
+
+	config := gitleaksConfig{}
+	err = toml.Unmarshal(data, &config)
+	if err != nil {
+		return []SecretType{}, err
+	}
+
+	secretTypes := []SecretType{}
+	for _, rule := range config.Rules {
+		if rule.Regex == "" {
+			continue
+		}
+
+		allowlist := []string{}
+		allowlist = append(allowlist, rule.Allowlist.Regexes...)
+		allowlist = append(allowlist, config.Allowlist.Regexes...)
+
+		secretTypes = append(secretTypes, SecretType{
+			Name:        rule.ID,
+			Regex:       rule.Regex,
+			Description: rule.Description,
+			Allowlist:   allowlist,
+			Entropy:     rule.Entropy,
+			SecretGroup: rule.SecretGroup,
+		})
+	}
+
+	return secretTypes, nil
+}
+
+// ReadSecretTypesFile reads a YAML or TOML rule file, chosen by the file
+// extension. TOML files without secret_types are read as gitleaks configs.
+func ReadSecretTypesFile(path string) ([]SecretType, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []SecretType{}, err
+	}
+
+	var secretTypes []SecretType
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		secretTypes, err = parseYAMLSecretTypes(data)
+	case ".toml":
+		secretTypes, err = parseTOMLSecretTypes(data)
+	default:
+		return []SecretType{}, fmt.Errorf(
+			"unknown rule file extension \"%s\"",
+			filepath.Ext(path),
+		)
+	}
+	if err != nil {
+		return []SecretType{}, err
+	}
+
+	for _, secretType := range secretTypes {
+		if secretType.Name == "" || secretType.Regex == "" {
+			return []SecretType{}, fmt.Errorf(
+				"secret type \"%s\" needs a name and a regex",
+				secretType.Name,
+			)
+		}
+	}
+
+	return secretTypes, nil
+}
+
+func (s *Scanner) ExportSecretTypes(w io.Writer, format string) error {
+	secretTypes, err := s.GetSecretTypes()
+	if err != nil {
+		return err
+	}
+
+	file := ruleFile{}
+	for _, secretType := range secretTypes {
+		file.SecretTypes = append(file.SecretTypes, ruleFileSecretType{
+			Name:        secretType.Name,
+			Regex:       secretType.Regex,
+			Description: secretType.Description,
+			Severity:    secretType.Severity,
+			Version:     secretType.Version,
+			Allowlist:   secretType.Allowlist,
+			Entropy:     secretType.Entropy,
+			SecretGroup: secretType.SecretGroup,
+		})
+	}
+
+	switch format {
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		err = encoder.Encode(file)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "toml":
+		return toml.NewEncoder(w).Encode(file)
+	default:
+		return fmt.Errorf("unknown rule file format \"%s\"", format)
+	}
+}
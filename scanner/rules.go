@@ -0,0 +1,193 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type compiledSecretType struct {
+	SecretType
+	regex     *regexp.Regexp
+	allowlist []*regexp.Regexp
+	// version identifies what the secret type matches, see ruleVersion
+	version string
+	// preferred are secret types whose matches this one does not report
+	// again, so generic detectors skip secrets a specific rule finds
+	preferred []compiledSecretType
+	// skipObjectIDs leaves out matches that are ids of objects in the
+	// scanned repository
+	skipObjectIDs bool
+}
+
+// objectIDs reports whether a string is the id of an object in the scanned
+// repository, such as a commit hash mentioned in a file.
+type objectIDs func(string) bool
+
+func repoObjectIDs(repo *git.Repository) objectIDs {
+	return func(value string) bool {
+		if len(value) != 2*len(plumbing.ZeroHash) {
+			return false
+		}
+
+		_, err := repo.Storer.EncodedObject(
+			plumbing.AnyObject,
+			plumbing.NewHash(value),
+		)
+
+		return err == nil
+	}
+}
+
+// ruleVersion hashes everything about secretType that affects which lines
+// match, so a commit or blob scanned with an older version of it is
+// scanned again.
+func ruleVersion(secretType SecretType) string {
+	data, _ := json.Marshal([]any{
+		secretType.Name,
+		secretType.Regex,
+		secretType.Allowlist,
+		secretType.Entropy,
+		secretType.SecretGroup,
+	})
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func compileSecretType(secretType SecretType) (compiledSecretType, error) {
+	re, err := regexp.Compile(secretType.Regex)
+	if err != nil {
+		return compiledSecretType{}, fmt.Errorf(
+			"invalid regex for secret type \"%s\": %w",
+			secretType.Name, err,
+		)
+	}
+
+	compiled := compiledSecretType{
+		SecretType: secretType,
+		regex:      re,
+		version:    ruleVersion(secretType),
+	}
+
+	for _, pattern := range secretType.Allowlist {
+		allowRe, err := regexp.Compile(pattern)
+		if err != nil {
+			return compiledSecretType{}, fmt.Errorf(
+				"invalid allowlist regex for secret type \"%s\": %w",
+				secretType.Name, err,
+			)
+		}
+		compiled.allowlist = append(compiled.allowlist, allowRe)
+	}
+
+	return compiled, nil
+}
+
+// secretBounds returns the part of a match that holds the secret: the
+// configured secret group, else the first non-empty capture group, or the
+// whole match if the regex has none.
+func (c compiledSecretType) secretBounds(match []int) (int, int) {
+	if c.SecretGroup > 0 && 2*c.SecretGroup+1 < len(match) {
+		start, end := match[2*c.SecretGroup], match[2*c.SecretGroup+1]
+		if start >= 0 {
+			return start, end
+		}
+	}
+
+	for i := 2; i+1 < len(match); i += 2 {
+		if match[i] >= 0 && match[i+1] > match[i] {
+			return match[i], match[i+1]
+		}
+	}
+
+	return match[0], match[1]
+}
+
+func (c compiledSecretType) isAllowlisted(secret string) bool {
+	for _, re := range c.allowlist {
+		if re.MatchString(secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type SecretMatch struct {
+	Secret  string
+	Entropy float64
+	// Suppressed holds the reason a match is not reported, if any
+	Suppressed string
+
+	start int
+	end   int
+}
+
+func (c compiledSecretType) findSecrets(line string) []SecretMatch {
+	matches := []SecretMatch{}
+	for _, match := range c.regex.FindAllStringSubmatchIndex(line, -1) {
+		start, end := c.secretBounds(match)
+		secret := line[start:end]
+		secretMatch := SecretMatch{
+			Secret:  secret,
+			Entropy: shannonEntropy(secret),
+			start:   start,
+			end:     end,
+		}
+
+		if c.isAllowlisted(secret) {
+			secretMatch.Suppressed = "allowlisted"
+		} else if c.Entropy > 0 && secretMatch.Entropy < c.Entropy {
+			secretMatch.Suppressed = fmt.Sprintf(
+				"entropy below %.2f",
+				c.Entropy,
+			)
+		} else if name := c.preferredMatch(line, start, end); name != "" {
+			secretMatch.Suppressed = "matched by " + name
+		}
+
+		matches = append(matches, secretMatch)
+	}
+
+	return matches
+}
+
+// preferredMatch returns the name of the preferred secret type with a match
+// overlapping line[start:end], or "" if there is none.
+func (c compiledSecretType) preferredMatch(line string, start int, end int) string {
+	for _, preferred := range c.preferred {
+		for _, match := range preferred.findSecrets(line) {
+			if match.Suppressed == "" && match.start < end && start < match.end {
+				return preferred.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+// TestSecretType matches the secret type called name against sample.
+func (s *Scanner) TestSecretType(name string, sample string) ([]SecretMatch, error) {
+	secretType, err := s.GetSecretType(name)
+	if err != nil {
+		return []SecretMatch{}, err
+	}
+
+	compiled, err := compileSecretType(secretType)
+	if err != nil {
+		return []SecretMatch{}, err
+	}
+
+	matches := []SecretMatch{}
+	for _, line := range splitLines(sample) {
+		matches = append(matches, compiled.findSecrets(line)...)
+	}
+
+	return matches, nil
+}
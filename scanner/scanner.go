@@ -2,9 +2,11 @@ package scanner
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"os"
-	"regexp"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,18 +17,108 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
+type ScanMode int
+
+const (
+	// ScanModeTree matches the whole tree of every commit
+	ScanModeTree ScanMode = iota
+	// ScanModeDiff only scans the lines each commit adds to its parents
+	ScanModeDiff
+)
+
+func (m ScanMode) String() string {
+	switch m {
+	case ScanModeDiff:
+		return "diff"
+	default:
+		return "tree"
+	}
+}
+
+func ParseScanMode(mode string) (ScanMode, error) {
+	switch mode {
+	case "tree":
+		return ScanModeTree, nil
+	case "diff":
+		return ScanModeDiff, nil
+	default:
+		return ScanModeTree, fmt.Errorf("unknown scan mode \"%s\"", mode)
+	}
+}
+
+type ScanOptions struct {
+	Mode ScanMode
+	// Entropy adds the generic high entropy string detectors to the scan
+	Entropy bool
+	// ShowSecrets stores the unredacted line along with each finding
+	ShowSecrets bool
+	// Branches, Tags and Refs select the refs to scan instead of HEAD. Refs
+	// holds ref name globs such as refs/heads/release/*
+	Branches bool
+	Tags     bool
+	Refs     []string
+	// Baseline holds accepted secrets. Scans still store them, so a later
+	// scan without the baseline lists them, but count them as suppressed
+	// instead of found
+	Baseline Baseline
+}
+
+// scanJob scans a commit with secretTypes, the ones it has not been scanned
+// with yet. Stored lines are masked with every secret type of the scan in
+// maskSecretTypes, so secrets of rules applied earlier are masked as well.
 type scanJob struct {
-	repoUrl     string
-	repo        *git.Repository
-	commit      object.Commit
-	secretTypes []SecretType
+	repoUrl         string
+	commit          object.Commit
+	secretTypes     []compiledSecretType
+	maskSecretTypes []compiledSecretType
+	objects         objectIDs
+	options         ScanOptions
+	wg              *sync.WaitGroup
 }
 
+// scanResult holds everything a worker found in one commit. The store
+// writes it in one transaction, so a commit is only marked as scanned with
+// all of its findings, or recorded as failed if err is set.
 type scanResult struct {
 	repoUrl    string
 	commitHash string
-	hasFinding bool
-	finding    Finding
+	findings   []Finding
+	suppressed map[string]int
+	blobs      []scannedBlob
+	// rules maps the secret types the commit was scanned with to their
+	// versions
+	rules map[string]string
+	err   error
+}
+
+// ScanSummary counts what a scan found. Suppressed matches are counted by
+// reason but not stored.
+type ScanSummary struct {
+	Commits int
+	// Failed counts the commits that could not be scanned or stored, they
+	// are retried by the next scan
+	Failed int
+	// Blobs counts the blobs matched, blobs scanned before are not
+	Blobs int
+	// Findings counts the findings stored that are neither in the baseline
+	// nor triaged as resolved before
+	Findings   int
+	Suppressed map[string]int
+	// FailedRepos holds the errors of repositories that could not be
+	// scanned at all, such as failed clones or fetches
+	FailedRepos map[string]error
+}
+
+func (s ScanSummary) add(other ScanSummary) ScanSummary {
+	s.Commits += other.Commits
+	s.Failed += other.Failed
+	s.Blobs += other.Blobs
+	s.Findings += other.Findings
+	for reason, count := range other.Suppressed {
+		s.Suppressed[reason] += count
+	}
+
+	return s
 }
 
 type scannerWorker struct {
@@ -49,64 +141,10 @@ type Scanner struct {
 	concurrentScannerWorkers int
 	scannerWorkerPool        *scannerWorkerPool
 	scanResultChan           chan scanResult
-}
-
-func (s *Scanner) createTablesIfNotExist() error {
-	_, err := s.db.Exec(
-		`
-			CREATE TABLE IF NOT EXISTS repositories (
-				url TEXT NOT NULL PRIMARY KEY
-			)
-		`,
-	)
-	if err != nil {
-		return err
-	}
-
-	_, err = s.db.Exec(
-		`
-			CREATE TABLE IF NOT EXISTS secret_types (
-				name TEXT NOT NULL PRIMARY KEY,
-				regex TEXT NOT NULL
-			)
-		`,
-	)
-	if err != nil {
-		return err
-	}
-
-	_, err = s.db.Exec(
-		`
-			CREATE TABLE IF NOT EXISTS scanned_commits (
-				repository TEXT NOT NULL,
-				commit_hash TEXT NOT NULL,
-				last_scanned_ts TIMESTAMP NOT NULL,
-				PRIMARY KEY (repository, commit_hash)
-			)
-		`,
-	)
-	if err != nil {
-		return err
-	}
-
-	_, err = s.db.Exec(
-		`
-			CREATE TABLE IF NOT EXISTS findings (
-				last_scanned_ts TIMESTAMP NOT NULL,
-				file_name TEXT NOT NULL,
-				line_number INT NOT NULL,
-				content TEXT NOT NULL,
-				tree_name TEXT NOT NULL,
-				repository TEXT NOT NULL,
-				secret_type TEXT NOT NULL,
-				FOREIGN KEY (secret_type) REFERENCES secret_type(type),
-				FOREIGN KEY (repository) REFERENCES repositories(url),
-				PRIMARY KEY (repository, tree_name)
-			)
-		`,
-	)
-
-	return err
+	credentials              []Credential
+	allowedPaths             pathAllowlist
+	blobCaches               map[string]*blobCache
+	blobCachesMu             sync.Mutex
 }
 
 func newScannerWorker(id int, jobChan chan scanJob) *scannerWorker {
@@ -124,18 +162,41 @@ func (w *scannerWorker) run(scanner *Scanner, wg *sync.WaitGroup) {
 			"ScannerWorker %d scanning repo %s, commit %s\n",
 			w.id, job.repoUrl, job.commit.Hash.String(),
 		)
-		err := scanner.scanCommit(
-			job.repo,
-			job.repoUrl,
-			job.commit.Hash,
-			job.secretTypes,
-		)
+		var result scanResult
+		var err error
+		switch job.options.Mode {
+		case ScanModeDiff:
+			result, err = scanner.scanCommitDiff(
+				job.repoUrl,
+				&job.commit,
+				job.secretTypes,
+				job.maskSecretTypes,
+				job.objects,
+				job.options,
+			)
+		default:
+			result, err = scanner.scanCommit(
+				job.repoUrl,
+				&job.commit,
+				job.secretTypes,
+				job.maskSecretTypes,
+				job.objects,
+				job.options,
+			)
+		}
 		if err != nil {
 			log.Printf(
 				"Could not scan repo %s, commit %s: %s\n",
 				job.repoUrl, job.commit.Hash.String(), err,
 			)
+			result = scanResult{
+				repoUrl:    job.repoUrl,
+				commitHash: job.commit.Hash.String(),
+				err:        err,
+			}
 		}
+		scanner.scanResultChan <- result
+		job.wg.Done()
 	}
 }
 
@@ -158,6 +219,7 @@ func (p *scannerWorkerPool) start(scanner *Scanner) {
 }
 
 func (p *scannerWorkerPool) wait() {
+	close(p.jobChan)
 	p.wg.Wait()
 }
 
@@ -175,6 +237,7 @@ func NewScanner(
 		repoDirPattern:           RepoDirPattern,
 		concurrentScannerWorkers: ConcurrentScannerWorkers,
 		scanResultChan:           make(chan scanResult),
+		blobCaches:               map[string]*blobCache{},
 	}
 
 	db, err := sql.Open(DBType, DBPath)
@@ -183,7 +246,7 @@ func NewScanner(
 	}
 	scanner.db = db
 
-	err = scanner.createTablesIfNotExist()
+	err = scanner.Migrate()
 	if err != nil {
 		return &Scanner{}, err
 	}
@@ -196,7 +259,12 @@ func NewScanner(
 }
 
 func (s *Scanner) AddSecretType(Name string, Regex string) error {
-	_, err := s.db.Exec(
+	_, err := compileSecretType(SecretType{Name: Name, Regex: Regex})
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
 		`
 			INSERT OR IGNORE INTO secret_types (name, regex)
 			VALUES (?, ?)
@@ -209,16 +277,108 @@ func (s *Scanner) AddSecretType(Name string, Regex string) error {
 }
 
 type SecretType struct {
-	Name  string
-	Regex string
+	Name        string
+	Regex       string
+	Description string
+	Version     int
+	Severity    string
+	Allowlist   []string
+	Entropy     float64
+	SecretGroup int
 }
 
-func (s *Scanner) GetSecretTypes() ([]SecretType, error) {
+// ImportSecretTypes adds secretTypes to the database. Existing secret types
+// are replaced if overwrite is set, otherwise only if the imported version
+// is newer than the stored one.
+func (s *Scanner) ImportSecretTypes(
+	secretTypes []SecretType,
+	overwrite bool,
+) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, secretType := range secretTypes {
+		_, err := compileSecretType(secretType)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	imported := 0
+	for _, secretType := range secretTypes {
+		allowlist, err := json.Marshal(secretType.Allowlist)
+		if err != nil {
+			return 0, err
+		}
+
+		result, err := tx.Exec(
+			`
+				INSERT INTO secret_types (
+					name,
+					regex,
+					description,
+					version,
+					severity,
+					allowlist,
+					entropy,
+					secret_group
+				)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (name) DO UPDATE SET
+					regex = excluded.regex,
+					description = excluded.description,
+					version = excluded.version,
+					severity = excluded.severity,
+					allowlist = excluded.allowlist,
+					entropy = excluded.entropy,
+					secret_group = excluded.secret_group
+				WHERE ? OR excluded.version > secret_types.version
+			`,
+			secretType.Name,
+			secretType.Regex,
+			secretType.Description,
+			secretType.Version,
+			secretType.Severity,
+			string(allowlist),
+			secretType.Entropy,
+			secretType.SecretGroup,
+			overwrite,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		imported += int(rowsAffected)
+	}
+
+	return imported, tx.Commit()
+}
+
+func (s *Scanner) querySecretTypes(
+	where string,
+	args ...any,
+) ([]SecretType, error) {
 	rows, err := s.db.Query(
 		`
-			SELECT name, regex
+			SELECT
+				name,
+				regex,
+				description,
+				version,
+				severity,
+				allowlist,
+				entropy,
+				secret_group
 			FROM secret_types
-		`,
+		`+where,
+		args...,
 	)
 
 	defer rows.Close()
@@ -230,7 +390,22 @@ func (s *Scanner) GetSecretTypes() ([]SecretType, error) {
 	secretTypes := []SecretType{}
 	for rows.Next() {
 		secretType := SecretType{}
-		err := rows.Scan(&secretType.Name, &secretType.Regex)
+		allowlist := ""
+		err := rows.Scan(
+			&secretType.Name,
+			&secretType.Regex,
+			&secretType.Description,
+			&secretType.Version,
+			&secretType.Severity,
+			&allowlist,
+			&secretType.Entropy,
+			&secretType.SecretGroup,
+		)
+		if err != nil {
+			return []SecretType{}, err
+		}
+
+		err = json.Unmarshal([]byte(allowlist), &secretType.Allowlist)
 		if err != nil {
 			return []SecretType{}, err
 		}
@@ -240,8 +415,88 @@ func (s *Scanner) GetSecretTypes() ([]SecretType, error) {
 	return secretTypes, nil
 }
 
+func (s *Scanner) GetSecretTypes() ([]SecretType, error) {
+	return s.querySecretTypes("")
+}
+
+func (s *Scanner) GetSecretType(Name string) (SecretType, error) {
+	secretTypes, err := s.querySecretTypes("WHERE name = ?", Name)
+	if err != nil {
+		return SecretType{}, err
+	}
+
+	if len(secretTypes) == 0 {
+		return SecretType{}, fmt.Errorf("unknown secret type \"%s\"", Name)
+	}
+
+	return secretTypes[0], nil
+}
+
+func (s *Scanner) UpdateSecretType(Name string, Regex string) error {
+	_, err := compileSecretType(SecretType{Name: Name, Regex: Regex})
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.Exec(
+		`
+			UPDATE secret_types
+			SET regex = ?
+			WHERE name = ?
+		`,
+		Regex,
+		Name,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireAffectedRow(result, "secret type", Name)
+}
+
+func (s *Scanner) RemoveSecretType(Name string) error {
+	result, err := s.db.Exec(
+		`
+			DELETE FROM secret_types
+			WHERE name = ?
+		`,
+		Name,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireAffectedRow(result, "secret type", Name)
+}
+
+func requireAffectedRow(result sql.Result, kind string, name string) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("unknown %s \"%s\"", kind, name)
+	}
+
+	return nil
+}
+
 func (s *Scanner) AddRepo(URL string) error {
-	_, err := s.db.Exec(
+	URL = normalizeRepoURL(URL)
+	err := checkNoCredentials(URL)
+	if err != nil {
+		return err
+	}
+
+	if path, ok := localRepoPath(URL); ok {
+		_, err = git.PlainOpen(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = s.db.Exec(
 		`
 			INSERT OR IGNORE INTO repositories(url)
 			VALUES (?)
@@ -252,11 +507,91 @@ func (s *Scanner) AddRepo(URL string) error {
 	return err
 }
 
+// RemoveRepo removes a repository and its cached mirror. If purge is set,
+// its scanned commits and findings are deleted as well.
+func (s *Scanner) RemoveRepo(URL string, purge bool) error {
+	URL = normalizeRepoURL(URL)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`
+			DELETE FROM repositories
+			WHERE url = ?
+		`,
+		URL,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = requireAffectedRow(result, "repository", URL)
+	if err != nil {
+		return err
+	}
+
+	if purge {
+		_, err = tx.Exec(
+			`
+				DELETE FROM scanned_commits
+				WHERE repository = ?
+			`,
+			URL,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`
+				DELETE FROM scanned_commit_rules
+				WHERE repository = ?
+			`,
+			URL,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			`
+				DELETE FROM failed_commits
+				WHERE repository = ?
+			`,
+			URL,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`
+				DELETE FROM findings
+				WHERE repository = ?
+			`,
+			URL,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return s.removeMirror(URL)
+}
+
 type Repository struct {
 	URL string
 }
 
 func (s *Scanner) GetRepo(URL string) (Repository, error) {
+	URL = normalizeRepoURL(URL)
 	rows, err := s.db.Query(
 		`
 			SELECT url
@@ -309,15 +644,27 @@ func (s *Scanner) GetRepos() ([]Repository, error) {
 	return repositories, nil
 }
 
+// execQueryer is satisfied by both *sql.DB and *sql.Tx.
+type execQueryer interface {
+	queryer
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func (s *Scanner) AddScannedCommit(repoUrl string, hash string) error {
-	_, err := s.db.Exec(
+	return addScannedCommit(s.db, repoUrl, hash)
+}
+
+func addScannedCommit(q execQueryer, repoUrl string, hash string) error {
+	_, err := q.Exec(
 		`
-			INSERT OR IGNORE INTO scanned_commits (
+			INSERT INTO scanned_commits (
 				last_scanned_ts,
 				repository,
 				commit_hash
 			)
 			VALUES (CURRENT_TIMESTAMP, ?, ?)
+			ON CONFLICT (repository, commit_hash) DO UPDATE SET
+				last_scanned_ts = excluded.last_scanned_ts
 		`,
 		repoUrl, hash,
 	)
@@ -326,189 +673,277 @@ func (s *Scanner) AddScannedCommit(repoUrl string, hash string) error {
 }
 
 type Finding struct {
+	ID                   int64
 	LastScannedTimestamp time.Time
 	FileName             string
 	LineNumber           int
 	Content              string
+	RawContent           string
+	SecretHash           string
+	Fingerprint          string
 	TreeName             string
+	CommitHash           string
+	CommitTimestamp      time.Time
+	AuthorName           string
+	AuthorEmail          string
+	CommitSubject        string
 	Repository           string
 	SecretType           string
+	Status               FindingStatus
+	Assignee             string
+	Note                 string
 }
 
 func (s *Scanner) AddFinding(
 	URL string,
 	SecretTypeName string,
 	TreeName string,
+	CommitHash string,
+	CommitTimestamp time.Time,
+	AuthorName string,
+	AuthorEmail string,
+	CommitSubject string,
 	FileName string,
 	LineNumber int,
 	Content string,
+	RawContent string,
+	SecretHash string,
 ) error {
-	_, err := s.db.Exec(
+	_, err := addFinding(s.db, Finding{
+		Repository:      URL,
+		SecretType:      SecretTypeName,
+		TreeName:        TreeName,
+		CommitHash:      CommitHash,
+		CommitTimestamp: CommitTimestamp,
+		AuthorName:      AuthorName,
+		AuthorEmail:     AuthorEmail,
+		CommitSubject:   CommitSubject,
+		FileName:        FileName,
+		LineNumber:      LineNumber,
+		Content:         Content,
+		RawContent:      RawContent,
+		SecretHash:      SecretHash,
+	})
+
+	return err
+}
+
+// addFinding stores finding with the triage of earlier findings of the same
+// secret and returns the status it was stored with.
+func addFinding(q execQueryer, finding Finding) (FindingStatus, error) {
+	Fingerprint := fingerprint(finding.SecretType, finding.SecretHash)
+	triage, err := previousTriage(q, Fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.Exec(
 		`
 			INSERT OR IGNORE INTO findings (
 				last_scanned_ts,
 				repository,
 				secret_type,
 				tree_name,
+				commit_hash,
+				commit_ts,
+				author_name,
+				author_email,
+				commit_subject,
 				file_name,
 				line_number,
-				content
+				content,
+				raw_content,
+				secret_hash,
+				fingerprint,
+				status,
+				assignee,
+				note
+			)
+			VALUES (
+				CURRENT_TIMESTAMP,
+				?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
 			)
-			VALUES (CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?)
 		`,
 
-		URL,
-		SecretTypeName,
-		TreeName,
-		FileName,
-		LineNumber,
-		Content,
-	)
-
-	return err
-}
-
-func (s *Scanner) GetFindings() ([]Finding, error) {
-	rows, err := s.db.Query(
-		`
-			SELECT
-				last_scanned_ts,
-				file_name,
-				line_number,
-				content,
-				tree_name,
-				repository,
-				secret_type
-			FROM findings
-		`,
+		finding.Repository,
+		finding.SecretType,
+		finding.TreeName,
+		finding.CommitHash,
+		finding.CommitTimestamp.UTC(),
+		finding.AuthorName,
+		finding.AuthorEmail,
+		finding.CommitSubject,
+		finding.FileName,
+		finding.LineNumber,
+		finding.Content,
+		finding.RawContent,
+		finding.SecretHash,
+		Fingerprint,
+		triage.Status,
+		triage.Assignee,
+		triage.Note,
 	)
-
-	defer rows.Close()
-
 	if err != nil {
-		return []Finding{}, err
+		return "", err
 	}
 
-	findings := []Finding{}
-	for rows.Next() {
-		finding := Finding{}
-		err := rows.Scan(
-			&finding.LastScannedTimestamp,
-			&finding.FileName,
-			&finding.LineNumber,
-			&finding.Content,
-			&finding.TreeName,
-			&finding.Repository,
-			&finding.SecretType,
-		)
-		if err != nil {
-			return []Finding{}, err
-		}
-		findings = append(findings, finding)
-	}
+	return triage.Status, nil
+}
 
-	return findings, nil
+func (s *Scanner) GetFindings() ([]Finding, error) {
+	return s.QueryFindings(FindingQuery{})
 }
 
-func (s *Scanner) storeScanResults() {
+// storeScanResults stores the results of a scan until the channel closes.
+// Findings in baseline are stored but counted as suppressed, findings of
+// secrets triaged as resolved before are not counted.
+func (s *Scanner) storeScanResults(baseline Baseline) ScanSummary {
 	log.Println("Starting storeScanResults")
 
+	summary := ScanSummary{Suppressed: map[string]int{}}
 	for result := range s.scanResultChan {
-		err := s.AddScannedCommit(result.repoUrl, result.commitHash)
-		if err != nil {
-			log.Printf(
-				"Could not add scanned commit %s %s: %s\n",
-				result.repoUrl, result.commitHash, err,
-			)
+		err := result.err
+		if err == nil {
+			err = s.storeScanResult(result)
+			if err != nil {
+				log.Printf(
+					"Could not store results of repo %s, commit %s: %s\n",
+					result.repoUrl, result.commitHash, err,
+				)
+			}
 		}
 
-		if result.hasFinding {
-			err := s.AddFinding(
-				result.finding.Repository,
-				result.finding.SecretType,
-				result.finding.TreeName,
-				result.finding.FileName,
-				result.finding.LineNumber,
-				result.finding.Content,
-			)
+		if err != nil {
+			summary.Failed++
+			err := s.addFailedCommit(result.repoUrl, result.commitHash, err)
 			if err != nil {
-				log.Printf("Could not add finding: %s\n", err)
+				log.Printf(
+					"Could not add failed commit %s %s: %s\n",
+					result.repoUrl, result.commitHash, err,
+				)
+			}
+			continue
+		}
+
+		summary.Commits++
+		summary.Blobs += len(result.blobs)
+		for _, finding := range result.findings {
+			if baseline.contains(finding) {
+				summary.Suppressed[SuppressedBaseline]++
+				continue
 			}
+			if !finding.Status.IsResolved() {
+				summary.Findings++
+			}
+		}
+		for reason, count := range result.suppressed {
+			summary.Suppressed[reason] += count
 		}
 	}
 
 	log.Println("Stopping storeScanResults")
-}
 
-func (s *Scanner) scanCommit(
-	repo *git.Repository,
-	repoUrl string,
-	commitHash plumbing.Hash,
-	secretTypes []SecretType,
-) error {
-	defer log.Printf("Done scanning repo %s, commit %s\n", repoUrl, commitHash)
+	return summary
+}
 
-	log.Printf("Scanning repo %s, commit %s\n", repoUrl, commitHash.String())
+// storeScanResult writes the findings of a commit and marks it as scanned
+// with its secret types in one transaction. The status each finding was
+// stored with is set on result.findings.
+func (s *Scanner) storeScanResult(result scanResult) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	for _, secretType := range secretTypes {
-		re, err := regexp.Compile(secretType.Regex)
+	for _, blob := range result.blobs {
+		err := addScannedBlob(tx, blob)
 		if err != nil {
-			log.Printf("Could not build regex: %s\n", err)
 			return err
 		}
+	}
 
-		grepResults, err := repo.Grep(&git.GrepOptions{
-			Patterns:   []*regexp.Regexp{re},
-			CommitHash: commitHash,
-		})
+	for i, finding := range result.findings {
+		status, err := addFinding(tx, finding)
 		if err != nil {
-			log.Printf("Could not grep repo %s: %s\n", repoUrl, err)
 			return err
 		}
+		result.findings[i].Status = status
+	}
 
-		s.scanResultChan <- scanResult{
-			repoUrl,
-			commitHash.String(),
-			false,
-			Finding{},
-		}
+	err = addScannedCommit(tx, result.repoUrl, result.commitHash)
+	if err != nil {
+		return err
+	}
 
-		for _, grepResult := range grepResults {
-			s.scanResultChan <- scanResult{
-				repoUrl,
-				commitHash.String(),
-				true,
-				Finding{
-					time.Time{},
-					grepResult.FileName,
-					grepResult.LineNumber,
-					grepResult.Content,
-					grepResult.TreeName,
-					repoUrl,
-					secretType.Name,
-				},
-			}
-		}
+	err = addScannedCommitRules(tx, result.repoUrl, result.commitHash, result.rules)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = removeFailedCommit(tx, result.repoUrl, result.commitHash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *Scanner) scanRepo(repoUrl string, wg *sync.WaitGroup) error {
-	defer wg.Done()
+// scanCommit matches the files of commit in tree mode. Blobs already
+// scanned with the same secret types, in this or any other repository, are
+// not matched again, only their cached matches are attributed to the commit.
+func (s *Scanner) scanCommit(
+	repoUrl string,
+	commit *object.Commit,
+	secretTypes []compiledSecretType,
+	maskSecretTypes []compiledSecretType,
+	objects objectIDs,
+	options ScanOptions,
+) (scanResult, error) {
+	commitHash := commit.Hash
 
-	rows, err := s.db.Query(
-		`
-			SELECT DISTINCT commit_hash
-			FROM scanned_commits
-			WHERE repository = ?
+	defer log.Printf("Done scanning repo %s, commit %s\n", repoUrl, commitHash)
 
-		`,
+	log.Printf("Scanning repo %s, commit %s\n", repoUrl, commitHash.String())
+
+	cache, err := s.blobCache(secretTypes)
+	if err != nil {
+		return scanResult{}, fmt.Errorf("could not load scanned blobs: %w", err)
+	}
+
+	findings, suppressed, blobs, err := s.blobFindings(
 		repoUrl,
+		commit,
+		secretTypes,
+		maskSecretTypes,
+		objects,
+		cache,
+		options,
 	)
+	if err != nil {
+		return scanResult{}, fmt.Errorf("could not read files: %w", err)
+	}
 
-	defer rows.Close()
+	return scanResult{
+		repoUrl,
+		commitHash.String(),
+		findings,
+		suppressed,
+		blobs,
+		scannedRules(secretTypes, s.allowedPaths),
+		nil,
+	}, nil
+}
+
+func (s *Scanner) scanRepo(
+	repoUrl string,
+	secretTypes []compiledSecretType,
+	options ScanOptions,
+	wg *sync.WaitGroup,
+) error {
+	defer wg.Done()
 
+	scannedRules, err := s.scannedCommitRules(repoUrl)
 	if err != nil {
 		log.Printf(
 			"Could not retrieve scanned commits from database: %s\n",
@@ -517,125 +952,313 @@ func (s *Scanner) scanRepo(repoUrl string, wg *sync.WaitGroup) error {
 		return err
 	}
 
-	var scannedCommitTreeHashes []string
-	for rows.Next() {
-		var scannedCommitTreeHash = ""
-		if err := rows.Scan(&scannedCommitTreeHash); err != nil {
-			log.Printf("Could not retrieve values from row: %s\n", err)
-			return err
-		}
-		scannedCommitTreeHashes = append(
-			scannedCommitTreeHashes,
-			scannedCommitTreeHash,
-		)
-	}
-
-	dir, err := os.MkdirTemp(s.workingDirectory, s.repoDirPattern)
+	repo, err := s.openMirror(repoUrl)
 	if err != nil {
-		log.Printf(
-			"Could not create temporary directory %s: %s\n",
-			repoUrl,
-			err,
-		)
+		log.Printf("Could not update mirror of repo %s: %s\n", repoUrl, err)
 		return err
 	}
-	defer os.RemoveAll(dir)
 
-	log.Printf("Cloning repo %s into %s\n", repoUrl, dir)
-	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
-		URL: repoUrl,
-	})
+	starts, err := startCommits(repo, options)
 	if err != nil {
-		log.Printf("Could not clone repo %s: %s\n", repoUrl, err)
+		log.Printf("Could not retrieve refs of %s: %s\n", repoUrl, err)
 		return err
 	}
-	log.Printf("Done cloning repo %s into %s\n", repoUrl, dir)
 
-	ref, err := repo.Head()
-	if err != nil {
-		log.Printf("Could not retrieve HEAD of %s: %s\n", repoUrl, err)
-		return err
+	objects := repoObjectIDs(repo)
+	var jobWg sync.WaitGroup
+	enqueue := func(commit *object.Commit) {
+		jobSecretTypes := secretTypesToScan(
+			secretTypes,
+			s.allowedPaths,
+			scannedRules[commit.Hash.String()],
+		)
+
+		if len(jobSecretTypes) > 0 {
+			jobWg.Add(1)
+			s.scannerWorkerPool.jobChan <- scanJob{
+				repoUrl,
+				*commit,
+				jobSecretTypes,
+				secretTypes,
+				objects,
+				options,
+				&jobWg,
+			}
+		}
 	}
 
-	commits, err := repo.Log(&git.LogOptions{From: ref.Hash()})
+	visited := map[plumbing.Hash]bool{}
+	err = walkCommits(
+		starts,
+		func(commit *object.Commit) error {
+			visited[commit.Hash] = true
+			enqueue(commit)
+
+			return nil
+		},
+	)
 	if err != nil {
+		jobWg.Wait()
 		log.Printf("Could not retrieve commit log of %s: %s\n", repoUrl, err)
 		return err
 	}
 
-	secretTypes, err := s.GetSecretTypes()
+	retries, err := s.failedCommitsToRetry(repoUrl, repo, visited)
 	if err != nil {
-		log.Printf("Could not retrieve secret types: %s\n", err)
-		return err
+		log.Printf("Could not retrieve failed commits of %s: %s\n", repoUrl, err)
 	}
+	for _, commit := range retries {
+		log.Printf("Retrying repo %s, commit %s\n", repoUrl, commit.Hash)
+		enqueue(commit)
+	}
+	jobWg.Wait()
 
-	commits.ForEach(
-		func(commit *object.Commit) error {
-			commitHasBeenScanned := false
-			for _, scannedCommitTreeHash := range scannedCommitTreeHashes {
-				if commit.Hash.String() == scannedCommitTreeHash {
-					commitHasBeenScanned = true
-					break
-				}
-			}
-
-			if !commitHasBeenScanned {
-				s.scannerWorkerPool.jobChan <- scanJob{
-					repoUrl,
-					repo,
-					*commit,
-					secretTypes,
-				}
-			}
+	return nil
+}
 
-			return nil
-		},
+// scannedCommitRules returns the versions of the secret types each commit of
+// the repository was scanned with, by commit hash and secret type name.
+func (s *Scanner) scannedCommitRules(
+	repoUrl string,
+) (map[string]map[string]string, error) {
+	rows, err := s.db.Query(
+		`
+			SELECT commit_hash, secret_type, rule_version
+			FROM scanned_commit_rules
+			WHERE repository = ?
+		`,
+		repoUrl,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scannedRules := map[string]map[string]string{}
+	for rows.Next() {
+		var commitHash, secretType, version string
+		err := rows.Scan(&commitHash, &secretType, &version)
+		if err != nil {
+			return nil, err
+		}
+
+		if scannedRules[commitHash] == nil {
+			scannedRules[commitHash] = map[string]string{}
+		}
+		scannedRules[commitHash][secretType] = version
+	}
+
+	return scannedRules, rows.Err()
+}
+
+// secretTypesToScan returns the secret types a commit has not been scanned
+// with in their current version and with the current path allowlist, given
+// the versions it was scanned with.
+func secretTypesToScan(
+	secretTypes []compiledSecretType,
+	allowedPaths pathAllowlist,
+	scanned map[string]string,
+) []compiledSecretType {
+	missing := []compiledSecretType{}
+	for _, secretType := range secretTypes {
+		if scanned[secretType.Name] != allowedPaths.commitRuleVersion(secretType) {
+			missing = append(missing, secretType)
+		}
+	}
+
+	return missing
+}
+
+// addScannedCommitRules records the versions of the secret types a commit
+// was scanned with.
+func addScannedCommitRules(
+	q execQueryer,
+	repoUrl string,
+	hash string,
+	rules map[string]string,
+) error {
+	for secretType, version := range rules {
+		_, err := q.Exec(
+			`
+				INSERT INTO scanned_commit_rules (
+					repository,
+					commit_hash,
+					secret_type,
+					rule_version
+				)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT (repository, commit_hash, secret_type) DO UPDATE SET
+					rule_version = excluded.rule_version
+			`,
+			repoUrl, hash, secretType, version,
+		)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (s *Scanner) ScanSingleRepo(repoUrl string) error {
-	repo, err := s.GetRepo(repoUrl)
-	if err != nil {
-		log.Printf("Could not get repo %s: %s\n", repoUrl, err)
-		return err
+// scannedRules maps secretTypes to their versions with allowedPaths, for the
+// scan result that marks a commit as scanned with them.
+func scannedRules(
+	secretTypes []compiledSecretType,
+	allowedPaths pathAllowlist,
+) map[string]string {
+	rules := map[string]string{}
+	for _, secretType := range secretTypes {
+		rules[secretType.Name] = allowedPaths.commitRuleVersion(secretType)
 	}
 
-	s.scannerWorkerPool.start(s)
-	go s.storeScanResults()
+	return rules
+}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go s.scanRepo(repo.URL, &wg)
-	wg.Wait()
+// compileSecretTypes compiles every secret type of a scan once, so workers
+// share the compiled regexes. Secret types with invalid regexes, which may
+// have been stored before they were validated, are skipped.
+func (s *Scanner) compileSecretTypes(
+	options ScanOptions,
+) ([]compiledSecretType, error) {
+	secretTypes, err := s.GetSecretTypes()
+	if err != nil {
+		return []compiledSecretType{}, err
+	}
 
-	close(s.scanResultChan)
+	compiledSecretTypes := []compiledSecretType{}
+	for _, secretType := range secretTypes {
+		compiled, err := compileSecretType(secretType)
+		if err != nil {
+			log.Printf("Skipping secret type %s: %s\n", secretType.Name, err)
+			continue
+		}
+		compiledSecretTypes = append(compiledSecretTypes, compiled)
+	}
 
-	s.scannerWorkerPool.wait()
+	specific := []compiledSecretType{}
+	for _, secretType := range compiledSecretTypes {
+		if !genericSecretTypes[secretType.Name] {
+			specific = append(specific, secretType)
+		}
+	}
+	for i, secretType := range compiledSecretTypes {
+		if genericSecretTypes[secretType.Name] {
+			compiledSecretTypes[i].preferred = specific
+		}
+	}
 
-	return nil
+	if options.Entropy {
+		preferred := compiledSecretTypes
+		for _, secretType := range HighEntropySecretTypes() {
+			compiled, err := compileSecretType(secretType)
+			if err != nil {
+				return []compiledSecretType{}, err
+			}
+			compiled.preferred = preferred
+			compiled.skipObjectIDs = true
+			compiledSecretTypes = append(compiledSecretTypes, compiled)
+		}
+	}
+
+	return compiledSecretTypes, nil
 }
 
-func (s *Scanner) ScanAll() error {
-	repos, err := s.GetRepos()
+func (s *Scanner) scanRepos(
+	repos []Repository,
+	options ScanOptions,
+) (ScanSummary, error) {
+	summary := ScanSummary{Suppressed: map[string]int{}}
+
+	secretTypes, err := s.compileSecretTypes(options)
 	if err != nil {
-		return err
+		log.Printf("Could not retrieve secret types: %s\n", err)
+		return summary, err
 	}
 
 	s.scannerWorkerPool.start(s)
-	go s.storeScanResults()
+
+	var storeWg sync.WaitGroup
+	storeWg.Add(1)
+	go func() {
+		defer storeWg.Done()
+		summary = s.storeScanResults(options.Baseline)
+	}()
 
 	var wg sync.WaitGroup
+	var failedReposMu sync.Mutex
+	failedRepos := map[string]error{}
 	for _, repo := range repos {
 		wg.Add(1)
-		go s.scanRepo(repo.URL, &wg)
+		go func(repoUrl string) {
+			err := s.scanRepo(repoUrl, secretTypes, options, &wg)
+			if err != nil {
+				failedReposMu.Lock()
+				failedRepos[repoUrl] = err
+				failedReposMu.Unlock()
+			}
+		}(repo.URL)
 	}
 	wg.Wait()
 
+	s.scannerWorkerPool.wait()
+
 	close(s.scanResultChan)
+	storeWg.Wait()
+	summary.FailedRepos = failedRepos
 
-	s.scannerWorkerPool.wait()
+	err = s.backfillCommitMetadata(repos)
+	if err != nil {
+		log.Printf("Could not backfill commit metadata: %s\n", err)
+	}
 
-	return nil
+	return summary, failedReposError(failedRepos)
+}
+
+// failedReposError combines the errors of repositories that could not be
+// scanned, or returns nil if there are none.
+func failedReposError(failedRepos map[string]error) error {
+	repoUrls := []string{}
+	for repoUrl := range failedRepos {
+		repoUrls = append(repoUrls, repoUrl)
+	}
+	sort.Strings(repoUrls)
+
+	errs := []error{}
+	for _, repoUrl := range repoUrls {
+		errs = append(errs, fmt.Errorf("%s: %w", repoUrl, failedRepos[repoUrl]))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Scanner) ScanSingleRepo(
+	repoUrl string,
+	options ScanOptions,
+) (ScanSummary, error) {
+	repo, err := s.GetRepo(repoUrl)
+	if err != nil {
+		log.Printf("Could not get repo %s: %s\n", repoUrl, err)
+		return ScanSummary{}, err
+	}
+
+	summary, err := s.scanRepos([]Repository{repo}, options)
+	if repoErr, ok := summary.FailedRepos[repo.URL]; ok {
+		return summary, repoErr
+	}
+
+	return summary, err
+}
+
+func (s *Scanner) ScanAll(options ScanOptions) (ScanSummary, error) {
+	repos, err := s.GetRepos()
+	if err != nil {
+		return ScanSummary{}, err
+	}
+
+	err = s.PruneMirrors()
+	if err != nil {
+		log.Printf("Could not prune mirrors: %s\n", err)
+	}
+
+	return s.scanRepos(repos, options)
 }